@@ -0,0 +1,285 @@
+package bqs
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+
+	"cloud.google.com/go/bigquery"
+)
+
+// Cache is a concurrency-safe cache of inference per Go type. It keeps static parts of struct inference, such as parsed struct tags, field lists and leaf types. Also, it keeps the whole schema of a struct type that does not depend on value, e.g. a struct without interface and map fields. Only interfaces, maps and value dependent fields are inspected for each inference.
+//
+// A Cache can be shared by InferWith, InferType and InferReflectType with different options, because cached schemas are distinguished by options that change the result. A TypeRegistry is distinguished by its identity, then types should be registered before the registry is used with the cache.
+type Cache struct {
+	fields  sync.Map // reflect.Type -> *cachedFields
+	leaves  sync.Map // reflect.Type -> cachedLeaf
+	static  sync.Map // staticKey -> bool
+	schemas sync.Map // schemaKey -> bigquery.Schema
+}
+
+// NewCache creates a new empty Cache.
+func NewCache() *Cache {
+	return &Cache{}
+}
+
+// WithCache enables the cache of inference per Go type. It is useful for inferring many values of the same struct types, e.g. ingestion of events.
+func WithCache(cache *Cache) InferOption {
+	return func(cfg *inferConfig) {
+		cfg.cache = cache
+	}
+}
+
+// structField is an exported field of a struct with parsed tags. tag is nil for embedded field.
+type structField struct {
+	index int
+	info  reflect.StructField
+	tag   *fieldTag
+}
+
+type cachedFields struct {
+	fields []*structField
+	err    error
+}
+
+type cachedLeaf struct {
+	fieldType bigquery.FieldType
+	ok        bool
+}
+
+// cacheVariant is a set of options that change whether a type is static and the schema of a static type. Options that affect only value dependent types, such as string detectors, are reduced to whether they are enabled.
+type cacheVariant struct {
+	static           bool
+	base64Bytes      bool
+	bigNumeric       bool
+	mapAsJSON        bool
+	marshaledForm    bool
+	detectString     bool
+	duration         DurationMode
+	nestedArrayField string
+	arrayConflict    ArrayConflictPolicy
+	maxDepth         int
+	deepRecordAsJSON bool
+	// registries is addresses of registries given by WithTypeRegistry, because a slice can not be a map key.
+	registries string
+}
+
+// staticKey is a key of cached result of isStaticType.
+type staticKey struct {
+	t       reflect.Type
+	variant cacheVariant
+}
+
+// schemaKey is a key of cached schema. The schema depends on the depth of RECORD because of the nesting limit.
+type schemaKey struct {
+	t       reflect.Type
+	depth   int
+	variant cacheVariant
+}
+
+// structFields returns exported fields of the struct type except skipped fields by tag. It works without cache if x is nil.
+func (x *Cache) structFields(t reflect.Type) ([]*structField, error) {
+	if x != nil {
+		if v, ok := x.fields.Load(t); ok {
+			cached := v.(*cachedFields)
+			return cached.fields, cached.err
+		}
+	}
+
+	fields, err := parseStructFields(t)
+	if x != nil {
+		x.fields.Store(t, &cachedFields{fields: fields, err: err})
+	}
+	return fields, err
+}
+
+func parseStructFields(t reflect.Type) ([]*structField, error) {
+	var fields []*structField
+	for i := 0; i < t.NumField(); i++ {
+		info := t.Field(i)
+		if !info.IsExported() {
+			continue
+		}
+
+		sf := &structField{
+			index: i,
+			info:  info,
+		}
+		if !info.Anonymous {
+			tag, err := parseFieldTag(info)
+			if err != nil {
+				return nil, err
+			}
+			if tag.skip {
+				continue
+			}
+			sf.tag = tag
+		}
+
+		fields = append(fields, sf)
+	}
+
+	return fields, nil
+}
+
+// lookupLeafType is cached version of lookupLeafType. It works without cache if x is nil.
+func (x *Cache) lookupLeafType(t reflect.Type) (bigquery.FieldType, bool) {
+	if x == nil {
+		return lookupLeafType(t)
+	}
+
+	if v, ok := x.leaves.Load(t); ok {
+		leaf := v.(cachedLeaf)
+		return leaf.fieldType, leaf.ok
+	}
+
+	fieldType, ok := lookupLeafType(t)
+	x.leaves.Store(t, cachedLeaf{fieldType: fieldType, ok: ok})
+	return fieldType, ok
+}
+
+func (x *Cache) loadSchema(key schemaKey) (bigquery.Schema, bool) {
+	v, ok := x.schemas.Load(key)
+	if !ok {
+		return nil, false
+	}
+	return cloneSchema(v.(bigquery.Schema)), true
+}
+
+func (x *Cache) storeSchema(key schemaKey, schema bigquery.Schema) {
+	x.schemas.Store(key, cloneSchema(schema))
+}
+
+// isStaticType returns true if the schema of the struct type t does not depend on value. It always returns false if x is nil, because the result is used only for cache.
+func (x *Cache) isStaticType(cfg *inferConfig, t reflect.Type) bool {
+	if x == nil {
+		return false
+	}
+
+	key := staticKey{t: t, variant: cfg.cacheVariant()}
+	if v, ok := x.static.Load(key); ok {
+		return v.(bool)
+	}
+
+	static := isStaticType(cfg, t, map[reflect.Type]bool{})
+	x.static.Store(key, static)
+	return static
+}
+
+// cacheVariant returns options of the config that change the cached results. It is computed once per inference.
+func (x *inferConfig) cacheVariant() cacheVariant {
+	if x.variant != nil {
+		return *x.variant
+	}
+
+	var registries strings.Builder
+	for _, registry := range x.registries {
+		fmt.Fprintf(&registries, "%p,", registry)
+	}
+	x.variant = &cacheVariant{
+		static:           x.static,
+		base64Bytes:      x.base64Bytes,
+		bigNumeric:       x.bigNumeric,
+		mapAsJSON:        x.mapAsJSON,
+		marshaledForm:    x.marshaledForm,
+		detectString:     len(x.detectors) > 0,
+		duration:         x.duration,
+		nestedArrayField: x.nestedArrayField,
+		arrayConflict:    x.arrayConflict,
+		maxDepth:         x.maxDepth,
+		deepRecordAsJSON: x.deepRecordAsJSON,
+		registries:       registries.String(),
+	}
+	return *x.variant
+}
+
+// isStaticType returns true if the schema of the type does not depend on value. A type in visiting is recursive type and treated as not static to avoid infinite loop.
+func isStaticType(cfg *inferConfig, t reflect.Type, visiting map[reflect.Type]bool) bool {
+	if cfg.static {
+		return true
+	}
+	if visiting[t] {
+		return false
+	}
+	if _, ok := cfg.lookupRegisteredType(t); ok {
+		return true
+	}
+	// provided schema may depend on value
+	if isProviderType(t) {
+		return false
+	}
+	// marshaled JSON may depend on value, but encoding.TextMarshaler is always STRING
+	if cfg.marshaledForm && isMarshalerType(t) {
+		return !t.Implements(jsonMarshalerType) && !reflect.PointerTo(t).Implements(jsonMarshalerType)
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		if t == jsonNumberType {
+			return false
+		}
+		// value of string may be inferred as other types by options
+		return !cfg.base64Bytes && len(cfg.detectors) == 0
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64, reflect.Bool:
+		return true
+
+	case reflect.Ptr:
+		return isStaticType(cfg, t.Elem(), visiting)
+
+	case reflect.Map:
+		return cfg.mapAsJSON
+
+	case reflect.Slice, reflect.Array:
+		if t == rawMessageType || t.Elem().Kind() == reflect.Uint8 {
+			return true
+		}
+		return isStaticType(cfg, t.Elem(), visiting)
+
+	case reflect.Struct:
+		if _, ok := lookupLeafType(t); ok {
+			return true
+		}
+		if isSQLNullType(t) {
+			return true
+		}
+
+		visiting[t] = true
+		defer delete(visiting, t)
+
+		fields, err := parseStructFields(t)
+		if err != nil {
+			return false
+		}
+		for _, sf := range fields {
+			if sf.tag != nil && (sf.tag.json || sf.tag.quoted || sf.tag.fieldType != "") {
+				continue
+			}
+			if !isStaticType(cfg, sf.info.Type, visiting) {
+				return false
+			}
+		}
+		return true
+
+	default:
+		return false
+	}
+}
+
+// cloneSchema returns a deep copy of the schema.
+func cloneSchema(schema bigquery.Schema) bigquery.Schema {
+	if schema == nil {
+		return nil
+	}
+
+	cloned := make(bigquery.Schema, len(schema))
+	for i, field := range schema {
+		copied := *field
+		copied.Schema = cloneSchema(field.Schema)
+		cloned[i] = &copied
+	}
+	return cloned
+}
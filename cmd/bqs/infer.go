@@ -14,7 +14,18 @@ import (
 
 func inferCommand() *cli.Command {
 	var (
-		output string
+		output      string
+		base64Bytes bool
+		mapAsJSON   bool
+		sortFields  bool
+
+		detectFormat    bool
+		detectNumber    bool
+		promoteRepeated bool
+		allConflicts    bool
+
+		nestedArrayField string
+		arrayConflict    string
 	)
 	return &cli.Command{
 		Name:        "infer",
@@ -28,6 +39,52 @@ func inferCommand() *cli.Command {
 				Value:       "-",
 				Destination: &output,
 			},
+			&cli.BoolFlag{
+				Name:        "base64-bytes",
+				Usage:       "Infer base64 encoded string as BYTES. A field that has both base64 and other strings is inferred as STRING",
+				Destination: &base64Bytes,
+			},
+			&cli.BoolFlag{
+				Name:        "map-as-json",
+				Usage:       "Infer nested object as JSON instead of RECORD",
+				Destination: &mapAsJSON,
+			},
+			&cli.BoolFlag{
+				Name:        "sort-fields",
+				Usage:       "Sort fields by name instead of first-seen order",
+				Destination: &sortFields,
+			},
+			&cli.BoolFlag{
+				Name:        "detect-format",
+				Usage:       "Infer string in format of timestamp, datetime, date, time and ISO-8601 duration as TIMESTAMP, DATETIME, DATE, TIME and INTERVAL",
+				Destination: &detectFormat,
+			},
+			&cli.BoolFlag{
+				Name:        "detect-number",
+				Usage:       "Infer numeric string as INTEGER or FLOAT",
+				Destination: &detectNumber,
+			},
+			&cli.StringFlag{
+				Name:        "nested-array-field",
+				Usage:       "Field name to wrap an element of nested array into RECORD. Nested array is rejected if not set",
+				Destination: &nestedArrayField,
+			},
+			&cli.BoolFlag{
+				Name:        "promote-repeated",
+				Usage:       "Infer a field that is scalar in a row and array in another row as REPEATED. Scalar values must be written as arrays of single element",
+				Destination: &promoteRepeated,
+			},
+			&cli.BoolFlag{
+				Name:        "all-conflicts",
+				Usage:       "Report all conflicts of a row instead of stopping at the first one",
+				Destination: &allConflicts,
+			},
+			&cli.StringFlag{
+				Name:        "array-conflict",
+				Usage:       "Policy for elements of different types in an array, fail, widen (to FLOAT or STRING) or json",
+				Value:       "fail",
+				Destination: &arrayConflict,
+			},
 		},
 		Action: func(c *cli.Context) error {
 			var w io.Writer
@@ -67,11 +124,96 @@ func inferCommand() *cli.Command {
 				}
 			}
 
+			policies := map[string]bqs.ArrayConflictPolicy{
+				"fail":  bqs.ArrayConflictFail,
+				"widen": bqs.ArrayConflictWiden,
+				"json":  bqs.ArrayConflictJSON,
+			}
+			policy, ok := policies[arrayConflict]
+			if !ok {
+				return goerr.New("Invalid array conflict policy").With("array-conflict", arrayConflict)
+			}
+
+			options := []bqs.InferOption{
+				bqs.WithArrayConflict(policy),
+				bqs.WithInferHook(func(r bqs.Resolution) {
+					logger.Debug("resolved conflict in array", "resolution", r.String())
+				}),
+			}
+			if base64Bytes {
+				options = append(options, bqs.WithBase64Bytes())
+			}
+			if mapAsJSON {
+				options = append(options, bqs.WithMapAsJSON())
+			}
+			if detectFormat {
+				options = append(options, bqs.WithStringDetector(bqs.DefaultStringDetectors()...))
+				options = append(options, bqs.WithStringDetector(bqs.DetectInterval))
+			}
+			if detectNumber {
+				options = append(options, bqs.WithStringDetector(bqs.DetectNumber))
+			}
+			if nestedArrayField != "" {
+				options = append(options, bqs.WithNestedArrayField(nestedArrayField))
+			}
+
+			// keep first-seen order of fields to make output reproducible
+			order := bqs.OrderOldFirst
+			if sortFields {
+				order = bqs.OrderByName
+			}
+			// input and line are updated for each row to report where the conflict is resolved
+			var input string
+			var line int
+
+			// promotions are summarized after all rows are merged, because a field is promoted again at every scalar value
+			type location struct {
+				input    string
+				line     int
+				scalarIn string
+			}
+			promoted := bqs.NewResolutionRecorder()
+			promotedAt := map[string]location{}
+
+			mergeOptions := []bqs.MergeOption{
+				bqs.WithFieldOrder(order),
+				// a number field may be integral in a row and fractional in another row, and a temporal field may be date in a row and timestamp in another row
+				bqs.WithWidening(bqs.WidenNumeric, bqs.WidenTemporal),
+				bqs.WithMergeHook(func(r bqs.Resolution) {
+					if r.Kind == bqs.ResolutionPromote {
+						// the new side is the current line, and the old side is merged from previous lines
+						scalarIn := "previous lines"
+						if !r.NewRepeated {
+							scalarIn = "this line"
+						}
+						if promoted.Record(r) {
+							promotedAt[r.Path] = location{input: input, line: line, scalarIn: scalarIn}
+						}
+						logger.Debug("promoted scalar field to REPEATED", "resolution", r.String(), "input", input, "line", line, "scalar_in", scalarIn)
+						return
+					}
+					logger.Debug("resolved conflict in merge", "resolution", r.String(), "input", input, "line", line)
+				}),
+			}
+			if detectFormat || detectNumber || base64Bytes {
+				// a string that is not in the format, such as "unknown" of timestamp field or "hello" of base64 field, makes the field STRING as same as auto-detection of BigQuery
+				mergeOptions = append(mergeOptions, bqs.WithWidening(bqs.WidenWithString))
+			}
+			if promoteRepeated {
+				mergeOptions = append(mergeOptions, bqs.WithRepeatedPromotion())
+			}
+			if allConflicts {
+				mergeOptions = append(mergeOptions, bqs.WithAllConflicts())
+			}
+
 			var schema bigquery.Schema
 			for _, reader := range readers {
 				logger.Debug("infer schema", "input", reader.name)
+				input = reader.name
 
 				decoder := json.NewDecoder(reader.r)
+				// keep numbers as json.Number to distinguish INTEGER from FLOAT
+				decoder.UseNumber()
 				for i := 0; ; i++ {
 					var data any
 					if err := decoder.Decode(&data); err != nil {
@@ -81,12 +223,13 @@ func inferCommand() *cli.Command {
 						return goerr.Wrap(err, "Failed to decode JSON data").With("input", reader.name)
 					}
 
-					inferred, err := bqs.Infer(data)
+					inferred, err := bqs.InferWith(data, options...)
 					if err != nil {
 						return goerr.Wrap(err, "Failed to infer schema").With("data", data).With("input", reader.name).With("line", i+1)
 					}
 
-					merged, err := bqs.Merge(schema, inferred)
+					line = i + 1
+					merged, err := bqs.MergeWith(schema, inferred, mergeOptions...)
 					if err != nil {
 						return goerr.Wrap(err, "Failed to merge schema").With("input", reader.name).With("line", i+1)
 					}
@@ -95,6 +238,12 @@ func inferCommand() *cli.Command {
 				}
 			}
 
+			for _, r := range promoted.Resolutions(bqs.ResolutionPromote) {
+				at := promotedAt[r.Path]
+				logger.Warn("promoted scalar field to REPEATED, scalar values of the field must be written as arrays of single element",
+					"field", r.Path, "input", at.input, "line", at.line, "scalar_in", at.scalarIn)
+			}
+
 			raw, err := schema.ToJSONFields()
 			if err != nil {
 				return goerr.Wrap(err, "Failed to convert schema to JSON")
@@ -30,8 +30,8 @@ func main() {
 				Name:        "log-output",
 				Category:    "Log",
 				Aliases:     []string{"L"},
-				Usage:       "Log output destination, stdout('-') or file path",
-				Value:       "-",
+				Usage:       "Log output destination, stdout('-'), stderr or file path",
+				Value:       "stderr",
 				Destination: &logOutput,
 			},
 		},
@@ -41,6 +41,9 @@ func main() {
 			switch logOutput {
 			case "-", "stdout":
 				logWriter = os.Stdout
+			case "stderr":
+				// schema is output to stdout by default, then logs should not be mixed into it
+				logWriter = os.Stderr
 			default:
 				file, err := os.Create(filepath.Clean(logOutput))
 				if err != nil {
@@ -0,0 +1,112 @@
+package bqs
+
+import (
+	"regexp"
+	"strconv"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"cloud.google.com/go/civil"
+)
+
+// StringDetector detects the field type from format of a string value. The second return value is false if the string is not in the format. It is useful for data decoded from JSON because JSON has no type other than string for such values.
+type StringDetector func(s string) (bigquery.FieldType, bool)
+
+// WithStringDetector enables detection of field type from format of string values. Detectors are applied in the order of arguments and the first detected type is used. A string that no detector matches is inferred as STRING, and elements of an array that are detected and not detected, such as ["2024-01-02", "foo"], are widened to STRING. Note that the schema of a field depends on the value, then fields of the same key may be inferred as different types across rows. Use MergeWith with WithWidening(WidenWithString) to widen them to STRING.
+func WithStringDetector(detectors ...StringDetector) InferOption {
+	return func(cfg *inferConfig) {
+		cfg.detectors = append(cfg.detectors, detectors...)
+	}
+}
+
+// iso8601DurationPattern matches ISO-8601 duration, such as "P1Y2M3DT4H5M6.5S" or "PT30M". Fraction is allowed only for seconds.
+var iso8601DurationPattern = regexp.MustCompile(`^-?P(\d+Y)?(\d+M)?(\d+W)?(\d+D)?(T(\d+H)?(\d+M)?(\d+(\.\d+)?S)?)?$`)
+
+// DetectInterval detects ISO-8601 duration string, such as "PT1H30M", as INTERVAL.
+func DetectInterval(s string) (bigquery.FieldType, bool) {
+	// "P" and "PT" without any component are not valid
+	if len(s) < 3 || s[len(s)-1] == 'P' || s[len(s)-1] == 'T' {
+		return "", false
+	}
+	if !iso8601DurationPattern.MatchString(s) {
+		return "", false
+	}
+	return bigquery.IntervalFieldType, true
+}
+
+// DefaultStringDetectors returns detectors of TIMESTAMP, DATETIME, DATE and TIME that are similar to auto-detection of BigQuery. Numeric strings are not detected by default because an identifier, such as zip code, is often a numeric string.
+func DefaultStringDetectors() []StringDetector {
+	return []StringDetector{
+		DetectTimestamp,
+		DetectDateTime,
+		DetectDate,
+		DetectTime,
+	}
+}
+
+// DetectTimestamp detects RFC3339 timestamp with time zone, such as "2024-01-02T03:04:05Z" or "2024-01-02 03:04:05.123+09:00", as TIMESTAMP.
+func DetectTimestamp(s string) (bigquery.FieldType, bool) {
+	if _, err := time.Parse(time.RFC3339, normalizeDateTimeSeparator(s)); err != nil {
+		return "", false
+	}
+	return bigquery.TimestampFieldType, true
+}
+
+// DetectDateTime detects civil datetime without time zone, such as "2024-01-02T03:04:05" or "2024-01-02 03:04:05.123", as DATETIME.
+func DetectDateTime(s string) (bigquery.FieldType, bool) {
+	if _, err := civil.ParseDateTime(normalizeDateTimeSeparator(s)); err != nil {
+		return "", false
+	}
+	return bigquery.DateTimeFieldType, true
+}
+
+// DetectDate detects "YYYY-MM-DD" date as DATE.
+func DetectDate(s string) (bigquery.FieldType, bool) {
+	if _, err := civil.ParseDate(s); err != nil {
+		return "", false
+	}
+	return bigquery.DateFieldType, true
+}
+
+// DetectTime detects "HH:MM:SS" time with optional fraction as TIME.
+func DetectTime(s string) (bigquery.FieldType, bool) {
+	if _, err := civil.ParseTime(s); err != nil {
+		return "", false
+	}
+	return bigquery.TimeFieldType, true
+}
+
+// decimalPattern matches decimal number with optional fraction and exponent. It excludes forms accepted by strconv.ParseFloat but not by BigQuery, such as "Inf", "NaN" and hexadecimal.
+var decimalPattern = regexp.MustCompile(`^[+-]?(\d+\.?\d*|\.\d+)([eE][+-]?\d+)?$`)
+
+// DetectNumber detects numeric string, such as "123" or "1.5", as INTEGER or FLOAT. An integer out of range of int64 is detected as FLOAT.
+func DetectNumber(s string) (bigquery.FieldType, bool) {
+	if _, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return bigquery.IntegerFieldType, true
+	}
+	if !decimalPattern.MatchString(s) {
+		return "", false
+	}
+	if _, err := strconv.ParseFloat(s, 64); err != nil {
+		return "", false
+	}
+	return bigquery.FloatFieldType, true
+}
+
+// normalizeDateTimeSeparator replaces a space between date and time with "T", because BigQuery accepts both of them.
+func normalizeDateTimeSeparator(s string) string {
+	if len(s) > 10 && s[10] == ' ' {
+		return s[:10] + "T" + s[11:]
+	}
+	return s
+}
+
+// detectString returns the field type detected by detectors of the config.
+func (x *inferConfig) detectString(s string) (bigquery.FieldType, bool) {
+	for _, detect := range x.detectors {
+		if fieldType, ok := detect(s); ok {
+			return fieldType, true
+		}
+	}
+	return "", false
+}
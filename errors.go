@@ -9,4 +9,8 @@ var (
 	ErrUnsupportedDataType = errors.New("unsupported data type")
 	ErrUnsupportedObject   = errors.New("unsupported object, must be struct or map")
 	ErrUnsupportedKeyType  = errors.New("unsupported map key type, must be string")
+	ErrInvalidTag          = errors.New("invalid struct tag")
+	ErrNestedArray         = errors.New("nested array is not supported by BigQuery")
+	ErrRecursiveType       = errors.New("recursive type is not supported")
+	ErrTooDeepNesting      = errors.New("too deep nesting of RECORD")
 )
@@ -5,6 +5,7 @@ go 1.23.0
 toolchain go1.24.2
 
 require (
+	cloud.google.com/go v0.121.3
 	cloud.google.com/go/bigquery v1.69.0
 	github.com/fatih/color v1.15.0
 	github.com/m-mizutani/clog v0.0.4
@@ -15,7 +16,6 @@ require (
 )
 
 require (
-	cloud.google.com/go v0.121.3 // indirect
 	cloud.google.com/go/auth v0.16.2 // indirect
 	cloud.google.com/go/auth/oauth2adapt v0.2.8 // indirect
 	cloud.google.com/go/compute/metadata v0.7.0 // indirect
@@ -1,76 +1,97 @@
 package bqs
 
 import (
+	"encoding/base64"
+	"errors"
 	"fmt"
 	"reflect"
-	"strings"
-	"time"
+	"sort"
+	"strconv"
 
 	"cloud.google.com/go/bigquery"
 )
 
 // Infer infers the schema of the data and returns a bigquery.Schema. It can infer the schema of nested structs and maps.
+// Fields of a struct are ordered by the struct definition followed by fields of embedded structs, and fields of a map are sorted by the key.
 func Infer(data any) (bigquery.Schema, error) {
-	return inferObject(reflect.ValueOf(data))
+	return InferWith(data)
 }
 
-func inferObject(data reflect.Value) (bigquery.Schema, error) {
-	var schema bigquery.Schema
-	var embedded bigquery.Schema
+// InferWith infers the schema of the data with options and returns a bigquery.Schema. Infer is a shortcut of InferWith without any option.
+func InferWith(data any, options ...InferOption) (bigquery.Schema, error) {
+	cfg := newInferConfig(options...)
+	return inferObject(cfg, reflect.ValueOf(data))
+}
+
+// InferType infers the schema of the type T without any value. The result depends only on the type, then it is stable and can be computed once, e.g. at startup. T must be struct or pointer to struct. Fields of map and interface types are inferred as JSON because their structure can not be determined from the type.
+func InferType[T any](options ...InferOption) (bigquery.Schema, error) {
+	return InferReflectType(reflect.TypeOf((*T)(nil)).Elem(), options...)
+}
+
+// InferReflectType infers the schema of the reflect.Type without any value. See InferType for details.
+func InferReflectType(t reflect.Type, options ...InferOption) (bigquery.Schema, error) {
+	if t == nil {
+		return nil, fmt.Errorf("nil type: %w", ErrUnsupportedObject)
+	}
+	base := t
+	for base.Kind() == reflect.Ptr {
+		base = base.Elem()
+	}
+	if base.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("invalid type: %v: %w", t, ErrUnsupportedObject)
+	}
+
+	cfg := newInferConfig(options...)
+	cfg.static = true
+	return inferObject(cfg, reflect.New(t).Elem())
+}
+
+func inferObject(cfg *inferConfig, data reflect.Value) (bigquery.Schema, error) {
+	if kind := data.Kind(); kind == reflect.Struct || kind == reflect.Map {
+		if schema, ok := provideSchema(data); ok {
+			return schema, nil
+		}
+	}
 
 	switch data.Kind() {
 	case reflect.Ptr, reflect.Interface:
 		if data.IsNil() {
+			if data.Kind() == reflect.Interface {
+				return nil, fmt.Errorf("nil interface: %w", ErrUnsupportedObject)
+			}
 			value := reflect.New(data.Type().Elem())
-			return inferObject(value)
+			return inferObject(cfg, value)
 		}
-		return inferObject(data.Elem())
+		return inferObject(cfg, data.Elem())
 
 	case reflect.Struct:
-		for i := 0; i < data.NumField(); i++ {
-			field := data.Field(i)
-			if !field.CanInterface() {
-				continue
-			}
-
-			fieldInfo := data.Type().Field(i)
-			if fieldInfo.Anonymous {
-				resp, err := inferObject(field)
-				if err != nil {
-					return nil, err
-				}
-				embedded = append(embedded, resp...)
-				continue
-			}
-
-			jsonTag := strings.Split(fieldInfo.Tag.Get("json"), ",")[0]
-			bqTag := fieldInfo.Tag.Get("bigquery")
-
-			var name string
-			switch {
-			case bqTag == "-":
-				continue
-			case bqTag != "":
-				name = bqTag
-			case jsonTag == "-":
-				continue
-			case jsonTag != "":
-				name = jsonTag
-			default:
-				name = fieldInfo.Name
+		// schema of static struct type does not depend on value, then it can be reused
+		if cfg.cache.isStaticType(cfg, data.Type()) {
+			key := schemaKey{t: data.Type(), depth: cfg.depth, variant: cfg.cacheVariant()}
+			if schema, ok := cfg.cache.loadSchema(key); ok {
+				return schema, nil
 			}
 
-			fieldSchema, err := inferField(name, field)
+			schema, err := inferStruct(cfg, data)
 			if err != nil {
 				return nil, err
 			}
-			if fieldSchema != nil {
-				schema = append(schema, fieldSchema)
-			}
+			cfg.cache.storeSchema(key, schema)
+			return schema, nil
 		}
 
+		return inferStruct(cfg, data)
+
 	case reflect.Map:
-		for _, key := range data.MapKeys() {
+		var schema bigquery.Schema
+
+		// sort keys to make the order of fields deterministic
+		keys := data.MapKeys()
+		sort.Slice(keys, func(i, j int) bool {
+			return keys[i].String() < keys[j].String()
+		})
+
+		for _, key := range keys {
 			value := data.MapIndex(key)
 			if !value.CanInterface() {
 				continue
@@ -79,7 +100,7 @@ func inferObject(data reflect.Value) (bigquery.Schema, error) {
 				return nil, fmt.Errorf("invalid key type: %v: %w", key.Kind(), ErrUnsupportedKeyType)
 			}
 
-			fieldSchema, err := inferField(key.String(), value)
+			fieldSchema, err := inferField(cfg, key.String(), value)
 			if err != nil {
 				return nil, err
 			}
@@ -88,9 +109,79 @@ func inferObject(data reflect.Value) (bigquery.Schema, error) {
 			}
 		}
 
+		return schema, nil
+
 	default:
 		return nil, fmt.Errorf("invalid data: %v: %w", data.Kind(), ErrUnsupportedObject)
 	}
+}
+
+func inferStruct(cfg *inferConfig, data reflect.Value) (bigquery.Schema, error) {
+	var schema bigquery.Schema
+	var embedded bigquery.Schema
+
+	cfg.stack = append(cfg.stack, typeFrame{t: data.Type(), depth: cfg.depth})
+	defer func() { cfg.stack = cfg.stack[:len(cfg.stack)-1] }()
+
+	fields, err := cfg.cache.structFields(data.Type())
+	if err != nil {
+		return nil, err
+	}
+
+	for _, sf := range fields {
+		field := data.Field(sf.index)
+
+		if sf.info.Anonymous {
+			// embedded struct is flatten into the same RECORD, then embedding itself never ends
+			embeddedType := sf.info.Type
+			if embeddedType.Kind() == reflect.Ptr {
+				embeddedType = embeddedType.Elem()
+			}
+			if cfg.inStack(embeddedType, cfg.depth) {
+				return nil, fmt.Errorf("embedded struct %v: %w", embeddedType, ErrRecursiveType)
+			}
+
+			resp, err := inferObject(cfg, field)
+			if err != nil {
+				return nil, err
+			}
+			embedded = append(embedded, resp...)
+			continue
+		}
+
+		tag := sf.tag
+		var fieldSchema *bigquery.FieldSchema
+		switch {
+		case tag.json:
+			fieldSchema = &bigquery.FieldSchema{
+				Name: tag.name,
+				Type: bigquery.JSONFieldType,
+			}
+		case tag.quoted:
+			fieldSchema = &bigquery.FieldSchema{
+				Name: tag.name,
+				Type: bigquery.StringFieldType,
+			}
+		case tag.fieldType != "":
+			fieldSchema = &bigquery.FieldSchema{
+				Name:     tag.name,
+				Type:     tag.fieldType,
+				Repeated: isRepeatedType(sf.info.Type),
+			}
+		default:
+			fieldSchema, err = inferField(cfg, tag.name, field)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		if fieldSchema != nil {
+			if err := tag.apply(fieldSchema); err != nil {
+				return nil, err
+			}
+			schema = append(schema, fieldSchema)
+		}
+	}
 
 	for _, field := range embedded {
 		var found bool
@@ -108,20 +199,66 @@ func inferObject(data reflect.Value) (bigquery.Schema, error) {
 	return schema, nil
 }
 
-func inferField(name string, data reflect.Value) (*bigquery.FieldSchema, error) {
+func inferField(cfg *inferConfig, name string, data reflect.Value) (*bigquery.FieldSchema, error) {
 	kind := data.Kind()
+
+	// custom mapping is prior to any other inference, because the type can not be modified in most cases
+	if data.IsValid() {
+		if fieldType, ok := cfg.lookupRegisteredType(data.Type()); ok {
+			return &bigquery.FieldSchema{
+				Name: name,
+				Type: fieldType,
+			}, nil
+		}
+	}
+
+	// the type defines its own column representation
+	if kind != reflect.Ptr && kind != reflect.Interface {
+		if field, ok := provideFieldSchema(name, data); ok {
+			return field, nil
+		}
+
+		if cfg.marshaledForm {
+			if field, ok, err := inferMarshaled(cfg, name, data); ok {
+				return field, err
+			}
+		}
+	}
+
 	switch kind {
 	case reflect.Ptr, reflect.Interface:
 		if data.IsNil() {
 			if data.Type().Kind() == reflect.Interface {
+				// the type of value is unknown without value
+				if cfg.static {
+					return &bigquery.FieldSchema{
+						Name: name,
+						Type: bigquery.JSONFieldType,
+					}, nil
+				}
 				return nil, nil
 			}
 			value := reflect.New(data.Type().Elem())
-			return inferField(name, value)
+			return inferZeroField(cfg, name, value)
 		}
-		return inferField(name, data.Elem())
+		return inferField(cfg, name, data.Elem())
 
 	case reflect.String:
+		if data.Type() == jsonNumberType {
+			return inferNumber(name, data.String()), nil
+		}
+		if fieldType, ok := cfg.detectString(data.String()); ok {
+			return &bigquery.FieldSchema{
+				Name: name,
+				Type: fieldType,
+			}, nil
+		}
+		if cfg.base64Bytes && isBase64(data.String()) {
+			return &bigquery.FieldSchema{
+				Name: name,
+				Type: bigquery.BytesFieldType,
+			}, nil
+		}
 		return &bigquery.FieldSchema{
 			Name: name,
 			Type: bigquery.StringFieldType,
@@ -129,6 +266,9 @@ func inferField(name string, data reflect.Value) (*bigquery.FieldSchema, error)
 
 	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
 		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if data.Type() == durationType {
+			return inferDuration(cfg, name), nil
+		}
 		return &bigquery.FieldSchema{
 			Name: name,
 			Type: bigquery.IntegerFieldType,
@@ -147,16 +287,59 @@ func inferField(name string, data reflect.Value) (*bigquery.FieldSchema, error)
 		}, nil
 
 	case reflect.Struct, reflect.Map:
-		// if data is time.Time, then it should be a TIMESTAMP
-		timeType := reflect.TypeOf(time.Time{})
-		if kind == reflect.Struct && data.Type().ConvertibleTo(timeType) {
+		// if data is time.Time, civil types, big.Rat or nullable wrapper types, then it should be a single column, not RECORD
+		if kind == reflect.Struct {
+			if fieldType, ok := cfg.cache.lookupLeafType(data.Type()); ok {
+				if fieldType == bigquery.NumericFieldType && cfg.bigNumeric {
+					fieldType = bigquery.BigNumericFieldType
+				}
+				return &bigquery.FieldSchema{
+					Name: name,
+					Type: fieldType,
+				}, nil
+			}
+			if isSQLNullType(data.Type()) {
+				return inferField(cfg, name, data.FieldByName("V"))
+			}
+		}
+		// keys of map are unknown without value
+		if kind == reflect.Map && (cfg.mapAsJSON || cfg.static) {
 			return &bigquery.FieldSchema{
 				Name: name,
-				Type: bigquery.TimestampFieldType,
+				Type: bigquery.JSONFieldType,
 			}, nil
 		}
 
-		schema, err := inferObject(data)
+		// zero value of a struct type that is being inferred never ends the recursion, then it must be a recursive type
+		if kind == reflect.Struct && (cfg.zero || cfg.static) && cfg.inStack(data.Type(), -1) {
+			if cfg.deepRecordAsJSON {
+				return &bigquery.FieldSchema{
+					Name: name,
+					Type: bigquery.JSONFieldType,
+				}, nil
+			}
+			return nil, fmt.Errorf("type %v of field '%s': %w", data.Type(), cfg.fieldPath(name), ErrRecursiveType)
+		}
+
+		if cfg.depth >= cfg.maxDepth {
+			switch {
+			case cfg.deepRecordAsJSON:
+				return &bigquery.FieldSchema{
+					Name: name,
+					Type: bigquery.JSONFieldType,
+				}, nil
+			case kind == reflect.Struct && cfg.inStack(data.Type(), -1):
+				return nil, fmt.Errorf("type %v of field '%s': %w", data.Type(), cfg.fieldPath(name), ErrRecursiveType)
+			default:
+				return nil, fmt.Errorf("field '%s' exceeds max depth %d: %w", cfg.fieldPath(name), cfg.maxDepth, ErrTooDeepNesting)
+			}
+		}
+
+		cfg.depth++
+		cfg.path = append(cfg.path, name)
+		schema, err := inferObject(cfg, data)
+		cfg.depth--
+		cfg.path = cfg.path[:len(cfg.path)-1]
 		if err != nil {
 			return nil, err
 		}
@@ -171,21 +354,36 @@ func inferField(name string, data reflect.Value) (*bigquery.FieldSchema, error)
 		}, nil
 
 	case reflect.Slice, reflect.Array:
+		// json.RawMessage is a JSON value as is
+		if data.Type() == rawMessageType {
+			return &bigquery.FieldSchema{
+				Name: name,
+				Type: bigquery.JSONFieldType,
+			}, nil
+		}
+
+		// []byte and [N]byte should be BYTES, not repeated INTEGER
+		if data.Type().Elem().Kind() == reflect.Uint8 {
+			return &bigquery.FieldSchema{
+				Name: name,
+				Type: bigquery.BytesFieldType,
+			}, nil
+		}
+
 		if data.Len() == 0 {
 			elem := reflect.New(data.Type().Elem()).Elem()
-			if elem.Kind() == reflect.Interface {
+			if elem.Kind() == reflect.Interface && !cfg.static {
 				return nil, nil
 			}
 
-			schema, err := inferField(name, elem)
+			schema, err := inferZeroField(cfg, name, elem)
 			if err != nil {
 				return nil, err
 			}
 			if schema == nil {
 				return nil, nil
 			}
-			schema.Repeated = true
-			return schema, nil
+			return repeatField(cfg, schema)
 		}
 
 		var field *bigquery.FieldSchema
@@ -195,31 +393,141 @@ func inferField(name string, data reflect.Value) (*bigquery.FieldSchema, error)
 				continue
 			}
 
-			newField, err := inferField(name, elem)
+			newField, err := inferField(cfg, name, elem)
 			if err != nil {
 				return nil, err
 			}
+			// skip nil element, such as null in JSON array
+			if newField == nil {
+				continue
+			}
 
 			if field == nil {
 				field = newField
 				continue
 			} else {
-				if newField.Type != field.Type {
-					return nil, fmt.Errorf("type conflict in array: %s: %w", name, ErrConflictField)
+				if newField.Type != field.Type || newField.Repeated != field.Repeated {
+					resolved, err := resolveArrayConflict(cfg, name, field, newField)
+					if err != nil {
+						return nil, err
+					}
+					if cfg.arrayConflict == ArrayConflictJSON && resolved == bigquery.JSONFieldType {
+						return &bigquery.FieldSchema{
+							Name: name,
+							Type: bigquery.JSONFieldType,
+						}, nil
+					}
+					field.Type = resolved
+					continue
 				}
 				if newField.Schema != nil {
-					merged, err := Merge(field.Schema, newField.Schema)
+					merged, err := MergeWith(field.Schema, newField.Schema,
+						// keep the order of fields in which they first appear in elements
+						WithFieldOrder(OrderOldFirst),
+						WithWidening(cfg.arrayWidening()...),
+						WithMergeHook(func(r Resolution) {
+							r.Path = cfg.fieldPath(name) + "." + r.Path
+							cfg.report(r)
+						}),
+					)
 					if err != nil {
+						if cfg.arrayConflict == ArrayConflictJSON && errors.Is(err, ErrConflictField) {
+							cfg.report(Resolution{
+								Kind:     ResolutionJSON,
+								Path:     cfg.fieldPath(name),
+								Old:      field.Type,
+								New:      newField.Type,
+								Resolved: bigquery.JSONFieldType,
+							})
+							return &bigquery.FieldSchema{
+								Name: name,
+								Type: bigquery.JSONFieldType,
+							}, nil
+						}
 						return nil, err
 					}
 					field.Schema = merged
 				}
 			}
 		}
-		field.Repeated = true
-		return field, nil
+		// all elements are nil, then it should be same as empty array
+		if field == nil {
+			return nil, nil
+		}
+		return repeatField(cfg, field)
 
 	default:
 		return nil, fmt.Errorf("invalid data type: %v: %w", data.Kind(), ErrUnsupportedDataType)
 	}
 }
+
+// inferZeroField infers the zero value created for nil pointer or empty slice. Values under the zero value are also zero values, then a struct type that appears again in them is detected as a recursive type.
+func inferZeroField(cfg *inferConfig, name string, value reflect.Value) (*bigquery.FieldSchema, error) {
+	zero := cfg.zero
+	cfg.zero = true
+	defer func() { cfg.zero = zero }()
+
+	return inferField(cfg, name, value)
+}
+
+// inferNumber infers json.Number as INTEGER if it is integral in range of int64, otherwise FLOAT.
+func inferNumber(name string, number string) *bigquery.FieldSchema {
+	fieldType := bigquery.FloatFieldType
+	if _, err := strconv.ParseInt(number, 10, 64); err == nil {
+		fieldType = bigquery.IntegerFieldType
+	}
+	return &bigquery.FieldSchema{
+		Name: name,
+		Type: fieldType,
+	}
+}
+
+// inferDuration infers time.Duration by DurationMode.
+func inferDuration(cfg *inferConfig, name string) *bigquery.FieldSchema {
+	switch cfg.duration {
+	case DurationAsInterval:
+		return &bigquery.FieldSchema{
+			Name: name,
+			Type: bigquery.IntervalFieldType,
+		}
+	case DurationAsNanoseconds:
+		return &bigquery.FieldSchema{
+			Name:        name,
+			Type:        bigquery.IntegerFieldType,
+			Description: durationDescription,
+		}
+	default:
+		return &bigquery.FieldSchema{
+			Name: name,
+			Type: bigquery.IntegerFieldType,
+		}
+	}
+}
+
+// repeatField makes the field of array element REPEATED. If the element is already REPEATED, the array is nested array that BigQuery can not store. It returns ErrNestedArray or wraps the element into RECORD by WithNestedArrayField option.
+func repeatField(cfg *inferConfig, field *bigquery.FieldSchema) (*bigquery.FieldSchema, error) {
+	if field.Repeated {
+		if cfg.nestedArrayField == "" {
+			return nil, fmt.Errorf("array of array: %s: %w", field.Name, ErrNestedArray)
+		}
+
+		inner := *field
+		inner.Name = cfg.nestedArrayField
+		field = &bigquery.FieldSchema{
+			Name:   field.Name,
+			Type:   bigquery.RecordFieldType,
+			Schema: bigquery.Schema{&inner},
+		}
+	}
+
+	field.Repeated = true
+	return field, nil
+}
+
+func isBase64(s string) bool {
+	if s == "" {
+		return false
+	}
+	_, err := base64.StdEncoding.Strict().DecodeString(s)
+	return err == nil
+}
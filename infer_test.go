@@ -1,10 +1,19 @@
 package bqs_test
 
 import (
+	"database/sql"
+	"encoding/json"
+	"math/big"
+	"net"
+	"net/netip"
+	"reflect"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	"cloud.google.com/go/bigquery"
+	"cloud.google.com/go/civil"
 	"github.com/m-mizutani/bqs"
 	"github.com/m-mizutani/gt"
 )
@@ -839,6 +848,103 @@ func TestTag(t *testing.T) {
 				},
 			},
 		},
+		"json string option makes field STRING": {
+			input: struct {
+				ID    int64    `json:"id,string"`
+				Rate  float64  `json:",string"`
+				Flag  *bool    `json:"flag,omitempty,string"`
+				Nest  struct{} `json:"nest,string"`
+				Count int      `json:"count,omitempty"`
+			}{},
+			expect: bigquery.Schema{
+				{
+					Name: "id",
+					Type: bigquery.StringFieldType,
+				},
+				{
+					Name: "Rate",
+					Type: bigquery.StringFieldType,
+				},
+				{
+					Name: "flag",
+					Type: bigquery.StringFieldType,
+				},
+				{
+					Name: "count",
+					Type: bigquery.IntegerFieldType,
+				},
+			},
+		},
+		"json string option with bigquery tag": {
+			input: struct {
+				ID int64 `bigquery:"user_id" json:"id,string"`
+			}{},
+			expect: bigquery.Schema{
+				{
+					Name: "user_id",
+					Type: bigquery.StringFieldType,
+				},
+			},
+		},
+		"bigquery tag with nullable option": {
+			input: struct {
+				Str string `bigquery:"user_name,nullable"`
+			}{
+				Str: "a",
+			},
+			expect: bigquery.Schema{
+				{
+					Name: "user_name",
+					Type: bigquery.StringFieldType,
+				},
+			},
+		},
+		"bigquery tag with only option": {
+			input: struct {
+				Str string `bigquery:",nullable"`
+			}{
+				Str: "a",
+			},
+			expect: bigquery.Schema{
+				{
+					Name: "Str",
+					Type: bigquery.StringFieldType,
+				},
+			},
+		},
+		"ignore json tag name if bigquery tag has only option": {
+			input: struct {
+				Str string `bigquery:",nullable" json:"red"`
+			}{
+				Str: "a",
+			},
+			expect: bigquery.Schema{
+				{
+					Name: "Str",
+					Type: bigquery.StringFieldType,
+				},
+			},
+		},
+		"bigquery tag with json option": {
+			input: struct {
+				Nest struct {
+					Str string
+				} `bigquery:"nest,json"`
+				Ptr *struct {
+					Int int
+				} `bigquery:",json"`
+			}{},
+			expect: bigquery.Schema{
+				{
+					Name: "nest",
+					Type: bigquery.JSONFieldType,
+				},
+				{
+					Name: "Ptr",
+					Type: bigquery.JSONFieldType,
+				},
+			},
+		},
 	}
 
 	for name, tc := range testCases {
@@ -850,6 +956,24 @@ func TestTag(t *testing.T) {
 	}
 }
 
+func TestTagNameCompatibleWithInferSchema(t *testing.T) {
+	type row struct {
+		// bigquery.InferSchema accepts nullable only for []byte and struct pointers
+		A []byte `bigquery:",nullable" json:"a_json"`
+		B []byte `bigquery:"b_bq,nullable" json:"b_json"`
+		C string `bigquery:"c_bq"`
+		D []byte `bigquery:",nullable"`
+		E string
+	}
+
+	expected := gt.R1(bigquery.InferSchema(row{})).NoError(t)
+	actual := gt.R1(bqs.Infer(row{})).NoError(t)
+	gt.A(t, actual).Length(len(expected))
+	for i := range expected {
+		gt.Equal(t, actual[i].Name, expected[i].Name)
+	}
+}
+
 func TestEmptyStructField(t *testing.T) {
 	s := struct {
 		Str  string
@@ -862,3 +986,1529 @@ func TestEmptyStructField(t *testing.T) {
 	gt.A(t, schemas).Length(1)
 	gt.Equal(t, schemas[0].Name, "Str")
 }
+
+func TestInferWithoutOption(t *testing.T) {
+	row := struct {
+		Str  string
+		Nest struct {
+			Int int
+		}
+	}{}
+
+	expect := gt.R1(bqs.Infer(row)).NoError(t)
+	schemas := gt.R1(bqs.InferWith(row)).NoError(t)
+	gt.True(t, bqs.Equal(schemas, expect))
+}
+
+func TestInvalidTag(t *testing.T) {
+	t.Run("unknown option", func(t *testing.T) {
+		row := struct {
+			Str string `bigquery:"name,unknown"`
+		}{}
+		_, err := bqs.Infer(row)
+		gt.Error(t, err).Is(bqs.ErrInvalidTag)
+	})
+
+	t.Run("json option for non-struct field", func(t *testing.T) {
+		row := struct {
+			Str string `bigquery:"name,json"`
+		}{}
+		_, err := bqs.Infer(row)
+		gt.Error(t, err).Is(bqs.ErrInvalidTag)
+	})
+}
+
+func TestBytes(t *testing.T) {
+	t.Run("byte slice and array", func(t *testing.T) {
+		row := struct {
+			Slice  []byte
+			Array  [16]byte
+			Ptr    *[]byte
+			Slices [][]byte
+		}{
+			Slices: [][]byte{[]byte("a"), []byte("b")},
+		}
+		schemas := gt.R1(bqs.Infer(row)).NoError(t)
+		gt.True(t, bqs.Equal(schemas, bigquery.Schema{
+			{Name: "Slice", Type: bigquery.BytesFieldType},
+			{Name: "Array", Type: bigquery.BytesFieldType},
+			{Name: "Ptr", Type: bigquery.BytesFieldType},
+			{Name: "Slices", Type: bigquery.BytesFieldType, Repeated: true},
+		}))
+	})
+
+	t.Run("base64 string", func(t *testing.T) {
+		row := map[string]any{
+			"data": "aGVsbG8gd29ybGQ=",
+			"str":  "hello world",
+		}
+
+		schemas := gt.R1(bqs.Infer(row)).NoError(t)
+		gt.True(t, bqs.Equal(schemas, bigquery.Schema{
+			{Name: "data", Type: bigquery.StringFieldType},
+			{Name: "str", Type: bigquery.StringFieldType},
+		}))
+
+		schemas = gt.R1(bqs.InferWith(row, bqs.WithBase64Bytes())).NoError(t)
+		gt.True(t, bqs.Equal(schemas, bigquery.Schema{
+			{Name: "data", Type: bigquery.BytesFieldType},
+			{Name: "str", Type: bigquery.StringFieldType},
+		}))
+		// base64 and plain strings in the same column
+		schemas = gt.R1(bqs.InferWith(map[string]any{
+			"data": []any{"aGk=", "hello world"},
+		}, bqs.WithBase64Bytes())).NoError(t)
+		gt.True(t, bqs.Equal(schemas, bigquery.Schema{
+			{Name: "data", Type: bigquery.StringFieldType, Repeated: true},
+		}))
+
+		var merged bigquery.Schema
+		for _, row := range []map[string]any{{"d": "aGk="}, {"d": "hello world"}} {
+			inferred := gt.R1(bqs.InferWith(row, bqs.WithBase64Bytes())).NoError(t)
+			merged = gt.R1(bqs.MergeWith(merged, inferred, bqs.WithWidening(bqs.WidenWithString))).NoError(t)
+		}
+		gt.True(t, bqs.Equal(merged, bigquery.Schema{
+			{Name: "d", Type: bigquery.StringFieldType},
+		}))
+	})
+}
+
+func TestCivil(t *testing.T) {
+	t.Run("struct fields", func(t *testing.T) {
+		var row struct {
+			Date     civil.Date
+			Time     *civil.Time
+			DateTime civil.DateTime
+			Dates    []civil.Date
+		}
+		schemas := gt.R1(bqs.Infer(row)).NoError(t)
+		gt.True(t, bqs.Equal(schemas, bigquery.Schema{
+			{Name: "Date", Type: bigquery.DateFieldType},
+			{Name: "Time", Type: bigquery.TimeFieldType},
+			{Name: "DateTime", Type: bigquery.DateTimeFieldType},
+			{Name: "Dates", Type: bigquery.DateFieldType, Repeated: true},
+		}))
+	})
+
+	t.Run("map values", func(t *testing.T) {
+		row := map[string]any{
+			"date":     civil.DateOf(time.Now()),
+			"time":     civil.TimeOf(time.Now()),
+			"datetime": &civil.DateTime{},
+			"dates":    []civil.Date{civil.DateOf(time.Now())},
+		}
+		schemas := gt.R1(bqs.Infer(row)).NoError(t)
+		gt.True(t, bqs.Equal(schemas, bigquery.Schema{
+			{Name: "date", Type: bigquery.DateFieldType},
+			{Name: "time", Type: bigquery.TimeFieldType},
+			{Name: "datetime", Type: bigquery.DateTimeFieldType},
+			{Name: "dates", Type: bigquery.DateFieldType, Repeated: true},
+		}))
+	})
+
+	t.Run("named type defined by civil type", func(t *testing.T) {
+		type myDate civil.Date
+		var row struct {
+			Date myDate
+		}
+		schemas := gt.R1(bqs.Infer(row)).NoError(t)
+		gt.True(t, bqs.Equal(schemas, bigquery.Schema{
+			{Name: "Date", Type: bigquery.DateFieldType},
+		}))
+	})
+
+	t.Run("struct with same fields is not civil type", func(t *testing.T) {
+		var row struct {
+			Clock struct{ Hour, Minute, Second, Nanosecond int }
+		}
+		schemas := gt.R1(bqs.Infer(row)).NoError(t)
+		gt.A(t, schemas).Length(1).At(0, func(t testing.TB, v *bigquery.FieldSchema) {
+			gt.Equal(t, v.Type, bigquery.RecordFieldType)
+			gt.A(t, v.Schema).Length(4)
+		})
+	})
+}
+
+func TestNumeric(t *testing.T) {
+	type decimal struct {
+		value string
+	}
+
+	t.Run("big.Rat is NUMERIC", func(t *testing.T) {
+		row := struct {
+			Price *big.Rat
+			Rates []*big.Rat
+		}{
+			Price: big.NewRat(1, 3),
+		}
+		schemas := gt.R1(bqs.Infer(row)).NoError(t)
+		gt.True(t, bqs.Equal(schemas, bigquery.Schema{
+			{Name: "Price", Type: bigquery.NumericFieldType},
+			{Name: "Rates", Type: bigquery.NumericFieldType, Repeated: true},
+		}))
+	})
+
+	t.Run("big.Rat is BIGNUMERIC with option", func(t *testing.T) {
+		row := map[string]any{
+			"price": big.NewRat(1, 3),
+		}
+		schemas := gt.R1(bqs.InferWith(row, bqs.WithBigNumeric())).NoError(t)
+		gt.True(t, bqs.Equal(schemas, bigquery.Schema{
+			{Name: "price", Type: bigquery.BigNumericFieldType},
+		}))
+	})
+
+	t.Run("bqs tag", func(t *testing.T) {
+		row := struct {
+			Price   *big.Rat  `bqs:"precision=10,scale=2"`
+			Total   big.Rat   `bqs:"bignumeric,precision=50,scale=20"`
+			Amount  decimal   `bqs:"numeric"`
+			Amounts []decimal `bqs:"numeric"`
+		}{}
+		schemas := gt.R1(bqs.Infer(row)).NoError(t)
+		gt.True(t, bqs.Equal(schemas, bigquery.Schema{
+			{Name: "Price", Type: bigquery.NumericFieldType, Precision: 10, Scale: 2},
+			{Name: "Total", Type: bigquery.BigNumericFieldType, Precision: 50, Scale: 20},
+			{Name: "Amount", Type: bigquery.NumericFieldType},
+			{Name: "Amounts", Type: bigquery.NumericFieldType, Repeated: true},
+		}))
+	})
+
+	t.Run("limits of precision depend on inferred type", func(t *testing.T) {
+		row := struct {
+			Price *big.Rat `bqs:"precision=40,scale=10"`
+		}{}
+		_, err := bqs.Infer(row)
+		gt.Error(t, err).Is(bqs.ErrInvalidTag)
+
+		schemas := gt.R1(bqs.InferWith(row, bqs.WithBigNumeric())).NoError(t)
+		gt.True(t, bqs.Equal(schemas, bigquery.Schema{
+			{Name: "Price", Type: bigquery.BigNumericFieldType, Precision: 40, Scale: 10},
+		}))
+	})
+
+	t.Run("invalid bqs tag", func(t *testing.T) {
+		testCases := map[string]any{
+			"unknown option": struct {
+				Price *big.Rat `bqs:"decimal"`
+			}{},
+			"invalid precision": struct {
+				Price *big.Rat `bqs:"precision=x"`
+			}{},
+			"scale without precision": struct {
+				Price *big.Rat `bqs:"scale=2"`
+			}{},
+			"scale larger than precision": struct {
+				Price *big.Rat `bqs:"precision=2,scale=3"`
+			}{},
+			"precision for non numeric field": struct {
+				Price float64 `bqs:"precision=10"`
+			}{},
+			"numeric scale exceeds limit": struct {
+				Price *big.Rat `bqs:"numeric,precision=20,scale=10"`
+			}{},
+			"numeric precision exceeds limit": struct {
+				Price *big.Rat `bqs:"numeric,precision=60,scale=20"`
+			}{},
+			"bignumeric scale exceeds limit": struct {
+				Price *big.Rat `bqs:"bignumeric,precision=50,scale=39"`
+			}{},
+			"bignumeric precision exceeds limit": struct {
+				Price *big.Rat `bqs:"bignumeric,precision=60,scale=20"`
+			}{},
+		}
+		for name, input := range testCases {
+			t.Run(name, func(t *testing.T) {
+				_, err := bqs.Infer(input)
+				gt.Error(t, err).Is(bqs.ErrInvalidTag)
+			})
+		}
+	})
+}
+
+func TestNullTypes(t *testing.T) {
+	t.Run("bigquery null types", func(t *testing.T) {
+		var row struct {
+			String    bigquery.NullString
+			Int64     bigquery.NullInt64
+			Float64   bigquery.NullFloat64
+			Bool      bigquery.NullBool
+			Timestamp bigquery.NullTimestamp
+			Date      bigquery.NullDate
+			Time      bigquery.NullTime
+			DateTime  bigquery.NullDateTime
+			Geography bigquery.NullGeography
+			JSON      *bigquery.NullJSON
+		}
+		schemas := gt.R1(bqs.Infer(row)).NoError(t)
+		gt.True(t, bqs.Equal(schemas, bigquery.Schema{
+			{Name: "String", Type: bigquery.StringFieldType},
+			{Name: "Int64", Type: bigquery.IntegerFieldType},
+			{Name: "Float64", Type: bigquery.FloatFieldType},
+			{Name: "Bool", Type: bigquery.BooleanFieldType},
+			{Name: "Timestamp", Type: bigquery.TimestampFieldType},
+			{Name: "Date", Type: bigquery.DateFieldType},
+			{Name: "Time", Type: bigquery.TimeFieldType},
+			{Name: "DateTime", Type: bigquery.DateTimeFieldType},
+			{Name: "Geography", Type: bigquery.GeographyFieldType},
+			{Name: "JSON", Type: bigquery.JSONFieldType},
+		}))
+	})
+
+	t.Run("database/sql null types", func(t *testing.T) {
+		row := map[string]any{
+			"string":  sql.NullString{String: "a", Valid: true},
+			"int64":   sql.NullInt64{},
+			"int32":   sql.NullInt32{},
+			"int16":   sql.NullInt16{},
+			"byte":    sql.NullByte{},
+			"float64": sql.NullFloat64{},
+			"bool":    sql.NullBool{},
+			"time":    &sql.NullTime{},
+			"generic": sql.Null[civil.Date]{},
+		}
+		schemas := gt.R1(bqs.Infer(row)).NoError(t)
+		gt.True(t, bqs.Equal(schemas, bigquery.Schema{
+			{Name: "string", Type: bigquery.StringFieldType},
+			{Name: "int64", Type: bigquery.IntegerFieldType},
+			{Name: "int32", Type: bigquery.IntegerFieldType},
+			{Name: "int16", Type: bigquery.IntegerFieldType},
+			{Name: "byte", Type: bigquery.IntegerFieldType},
+			{Name: "float64", Type: bigquery.FloatFieldType},
+			{Name: "bool", Type: bigquery.BooleanFieldType},
+			{Name: "time", Type: bigquery.TimestampFieldType},
+			{Name: "generic", Type: bigquery.DateFieldType},
+		}))
+	})
+
+	t.Run("struct with same fields is not null type", func(t *testing.T) {
+		var row struct {
+			Name struct {
+				String string
+				Valid  bool
+			}
+			Count struct {
+				Int64 int64
+				Valid bool
+			}
+		}
+		schemas := gt.R1(bqs.Infer(row)).NoError(t)
+		gt.A(t, schemas).Length(2).
+			At(0, func(t testing.TB, v *bigquery.FieldSchema) {
+				gt.Equal(t, v.Type, bigquery.RecordFieldType)
+				gt.A(t, v.Schema).Length(2)
+			}).
+			At(1, func(t testing.TB, v *bigquery.FieldSchema) {
+				gt.Equal(t, v.Type, bigquery.RecordFieldType)
+				gt.A(t, v.Schema).Length(2)
+			})
+	})
+}
+
+func TestJSON(t *testing.T) {
+	t.Run("json.RawMessage", func(t *testing.T) {
+		row := struct {
+			Raw  json.RawMessage
+			Raws []json.RawMessage
+		}{
+			Raw: json.RawMessage(`{"a":1}`),
+		}
+		schemas := gt.R1(bqs.Infer(row)).NoError(t)
+		gt.True(t, bqs.Equal(schemas, bigquery.Schema{
+			{Name: "Raw", Type: bigquery.JSONFieldType},
+			{Name: "Raws", Type: bigquery.JSONFieldType, Repeated: true},
+		}))
+	})
+
+	t.Run("json tag for map field", func(t *testing.T) {
+		row := struct {
+			Payload map[string]any `bigquery:"payload,json"`
+			Labels  map[string]string
+		}{
+			Payload: map[string]any{"a": 1},
+			Labels:  map[string]string{"b": "c"},
+		}
+		schemas := gt.R1(bqs.Infer(row)).NoError(t)
+		gt.True(t, bqs.Equal(schemas, bigquery.Schema{
+			{Name: "payload", Type: bigquery.JSONFieldType},
+			{Name: "Labels", Type: bigquery.RecordFieldType, Schema: bigquery.Schema{
+				{Name: "b", Type: bigquery.StringFieldType},
+			}},
+		}))
+	})
+
+	t.Run("json tag for interface field", func(t *testing.T) {
+		row := struct {
+			Payload any  `bigquery:"payload,json"`
+			Extra   *any `bigquery:"extra,json"`
+			Empty   any  `bigquery:"empty,json"`
+		}{
+			Payload: map[string]any{"a": 1},
+		}
+		schemas := gt.R1(bqs.Infer(row)).NoError(t)
+		gt.True(t, bqs.Equal(schemas, bigquery.Schema{
+			{Name: "payload", Type: bigquery.JSONFieldType},
+			{Name: "extra", Type: bigquery.JSONFieldType},
+			{Name: "empty", Type: bigquery.JSONFieldType},
+		}))
+	})
+
+	t.Run("map as JSON option", func(t *testing.T) {
+		row := map[string]any{
+			"name": "a",
+			"payload": map[string]any{
+				"b": 1,
+			},
+			"payloads": []map[string]any{
+				{"c": 2},
+			},
+		}
+		schemas := gt.R1(bqs.InferWith(row, bqs.WithMapAsJSON())).NoError(t)
+		gt.True(t, bqs.Equal(schemas, bigquery.Schema{
+			{Name: "name", Type: bigquery.StringFieldType},
+			{Name: "payload", Type: bigquery.JSONFieldType},
+			{Name: "payloads", Type: bigquery.JSONFieldType, Repeated: true},
+		}))
+	})
+}
+
+func TestInferMapOrder(t *testing.T) {
+	row := map[string]any{
+		"c": 1,
+		"a": "x",
+		"b": map[string]any{
+			"z": 1,
+			"y": 2,
+		},
+	}
+
+	for i := 0; i < 10; i++ {
+		schemas := gt.R1(bqs.Infer(row)).NoError(t)
+		gt.A(t, schemas).Length(3).
+			At(0, func(t testing.TB, v *bigquery.FieldSchema) {
+				gt.Equal(t, v.Name, "a")
+			}).
+			At(1, func(t testing.TB, v *bigquery.FieldSchema) {
+				gt.Equal(t, v.Name, "b")
+				gt.A(t, v.Schema).Length(2).
+					At(0, func(t testing.TB, v *bigquery.FieldSchema) {
+						gt.Equal(t, v.Name, "y")
+					}).
+					At(1, func(t testing.TB, v *bigquery.FieldSchema) {
+						gt.Equal(t, v.Name, "z")
+					})
+			}).
+			At(2, func(t testing.TB, v *bigquery.FieldSchema) {
+				gt.Equal(t, v.Name, "c")
+			})
+	}
+}
+
+func TestInferArrayElementOrder(t *testing.T) {
+	row := map[string]any{
+		"x": []any{
+			map[string]any{"b": 1},
+			map[string]any{"a": 1, "c": 1},
+		},
+	}
+
+	schemas := gt.R1(bqs.Infer(row)).NoError(t)
+	gt.A(t, schemas).Length(1).At(0, func(t testing.TB, v *bigquery.FieldSchema) {
+		// fields are in the order in which they first appear in elements
+		var names []string
+		for _, field := range v.Schema {
+			names = append(names, field.Name)
+		}
+		gt.Equal(t, names, []string{"b", "a", "c"})
+	})
+}
+
+func TestInferArrayWithNil(t *testing.T) {
+	testCases := map[string]struct {
+		input  any
+		expect bigquery.Schema
+	}{
+		"nil element in any array": {
+			input: map[string]any{
+				"tags": []any{nil, "a"},
+			},
+			expect: bigquery.Schema{
+				{Name: "tags", Type: bigquery.StringFieldType, Repeated: true},
+			},
+		},
+		"nil element at the end": {
+			input: map[string]any{
+				"tags": []any{"a", nil},
+			},
+			expect: bigquery.Schema{
+				{Name: "tags", Type: bigquery.StringFieldType, Repeated: true},
+			},
+		},
+		"all nil elements": {
+			input: map[string]any{
+				"name": "a",
+				"tags": []any{nil, nil},
+			},
+			expect: bigquery.Schema{
+				{Name: "name", Type: bigquery.StringFieldType},
+			},
+		},
+		"nil map element": {
+			input: map[string]any{
+				"items": []any{nil, map[string]any{"a": 1}},
+			},
+			expect: bigquery.Schema{
+				{Name: "items", Type: bigquery.RecordFieldType, Repeated: true, Schema: bigquery.Schema{
+					{Name: "a", Type: bigquery.IntegerFieldType},
+				}},
+			},
+		},
+		"empty map elements": {
+			input: map[string]any{
+				"name":  "a",
+				"items": []any{map[string]any{}, map[string]any{}},
+			},
+			expect: bigquery.Schema{
+				{Name: "name", Type: bigquery.StringFieldType},
+			},
+		},
+		"nil pointer elements": {
+			input: struct {
+				Items []*struct {
+					Str string
+				}
+			}{
+				Items: []*struct {
+					Str string
+				}{nil, nil},
+			},
+			expect: bigquery.Schema{
+				{Name: "Items", Type: bigquery.RecordFieldType, Repeated: true, Schema: bigquery.Schema{
+					{Name: "Str", Type: bigquery.StringFieldType},
+				}},
+			},
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			schemas := gt.R1(bqs.Infer(tc.input)).NoError(t)
+			gt.True(t, bqs.Equal(schemas, tc.expect))
+		})
+	}
+}
+
+func TestNestedArray(t *testing.T) {
+	testCases := map[string]struct {
+		input any
+	}{
+		"slice of slice": {
+			input: struct {
+				Values [][]int
+			}{
+				Values: [][]int{{1, 2}, {3}},
+			},
+		},
+		"empty slice of slice": {
+			input: struct {
+				Values [][]int
+			}{},
+		},
+		"nested JSON array": {
+			input: map[string]any{
+				"values": []any{[]any{1, 2}, []any{3}},
+			},
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name+" is rejected", func(t *testing.T) {
+			_, err := bqs.Infer(tc.input)
+			gt.Error(t, err).Is(bqs.ErrNestedArray)
+		})
+
+		t.Run(name+" is wrapped", func(t *testing.T) {
+			schemas := gt.R1(bqs.InferWith(tc.input, bqs.WithNestedArrayField("values"))).NoError(t)
+			gt.A(t, schemas).Length(1).At(0, func(t testing.TB, v *bigquery.FieldSchema) {
+				gt.Equal(t, v.Type, bigquery.RecordFieldType)
+				gt.Equal(t, v.Repeated, true)
+				gt.Equal(t, bqs.Equal(v.Schema, bigquery.Schema{
+					{Name: "values", Type: bigquery.IntegerFieldType, Repeated: true},
+				}), true)
+			})
+		})
+	}
+
+	t.Run("mixed array and scalar", func(t *testing.T) {
+		input := map[string]any{
+			"values": []any{[]any{1, 2}, 3},
+		}
+		_, err := bqs.InferWith(input, bqs.WithNestedArrayField("values"))
+		gt.Error(t, err).Is(bqs.ErrConflictField)
+	})
+
+	t.Run("triple nested array", func(t *testing.T) {
+		input := map[string]any{
+			"values": []any{[]any{[]any{"a"}}},
+		}
+		schemas := gt.R1(bqs.InferWith(input, bqs.WithNestedArrayField("v"))).NoError(t)
+		gt.True(t, bqs.Equal(schemas, bigquery.Schema{
+			{Name: "values", Type: bigquery.RecordFieldType, Repeated: true, Schema: bigquery.Schema{
+				{Name: "v", Type: bigquery.RecordFieldType, Repeated: true, Schema: bigquery.Schema{
+					{Name: "v", Type: bigquery.StringFieldType, Repeated: true},
+				}},
+			}},
+		}))
+	})
+}
+
+type recursiveNode struct {
+	Name     string
+	Children []*recursiveNode
+}
+
+type recursiveMapNode struct {
+	Name     string
+	Children map[string]*recursiveMapNode
+}
+
+func TestRecursiveType(t *testing.T) {
+	t.Run("recursive slice", func(t *testing.T) {
+		_, err := bqs.Infer(recursiveNode{Name: "root"})
+		gt.Error(t, err).Is(bqs.ErrRecursiveType)
+	})
+
+	t.Run("recursive nil pointer", func(t *testing.T) {
+		row := struct {
+			Node *recursiveNode
+		}{}
+		_, err := bqs.Infer(row)
+		gt.Error(t, err).Is(bqs.ErrRecursiveType)
+	})
+
+	t.Run("recursive embedded struct", func(t *testing.T) {
+		type Embedded struct {
+			*Embedded
+			Name string
+		}
+		_, err := bqs.Infer(Embedded{Name: "a"})
+		gt.Error(t, err).Is(bqs.ErrRecursiveType)
+	})
+
+	t.Run("fallback to JSON", func(t *testing.T) {
+		schemas := gt.R1(bqs.InferWith(recursiveNode{}, bqs.WithDeepRecordAsJSON())).NoError(t)
+		gt.True(t, bqs.Equal(schemas, bigquery.Schema{
+			{Name: "Name", Type: bigquery.StringFieldType},
+			{Name: "Children", Type: bigquery.JSONFieldType, Repeated: true},
+		}))
+	})
+
+	t.Run("fallback to JSON at the recursion of data", func(t *testing.T) {
+		row := recursiveNode{
+			Name:     "root",
+			Children: []*recursiveNode{{Name: "child"}},
+		}
+		schemas := gt.R1(bqs.InferWith(row, bqs.WithDeepRecordAsJSON())).NoError(t)
+		gt.True(t, bqs.Equal(schemas, bigquery.Schema{
+			{Name: "Name", Type: bigquery.StringFieldType},
+			{Name: "Children", Type: bigquery.RecordFieldType, Repeated: true, Schema: bigquery.Schema{
+				{Name: "Name", Type: bigquery.StringFieldType},
+				{Name: "Children", Type: bigquery.JSONFieldType, Repeated: true},
+			}},
+		}))
+	})
+
+	t.Run("multiple self-referencing fields", func(t *testing.T) {
+		type Tree struct {
+			V          int
+			A, B, C, D *Tree
+		}
+
+		schemas := gt.R1(bqs.InferWith(Tree{}, bqs.WithDeepRecordAsJSON())).NoError(t)
+		gt.True(t, bqs.Equal(schemas, bigquery.Schema{
+			{Name: "V", Type: bigquery.IntegerFieldType},
+			{Name: "A", Type: bigquery.JSONFieldType},
+			{Name: "B", Type: bigquery.JSONFieldType},
+			{Name: "C", Type: bigquery.JSONFieldType},
+			{Name: "D", Type: bigquery.JSONFieldType},
+		}))
+
+		_, err := bqs.Infer(Tree{A: &Tree{}})
+		gt.Error(t, err).Is(bqs.ErrRecursiveType)
+		gt.True(t, strings.Contains(err.Error(), "field 'A.A'"))
+
+		_, err = bqs.InferType[Tree]()
+		gt.Error(t, err).Is(bqs.ErrRecursiveType)
+		gt.True(t, strings.Contains(err.Error(), "field 'A'"))
+	})
+
+	t.Run("finite recursive data", func(t *testing.T) {
+		row := recursiveMapNode{
+			Name: "root",
+			Children: map[string]*recursiveMapNode{
+				"a": {Name: "a"},
+			},
+		}
+		schemas := gt.R1(bqs.Infer(row)).NoError(t)
+		gt.True(t, bqs.Equal(schemas, bigquery.Schema{
+			{Name: "Name", Type: bigquery.StringFieldType},
+			{Name: "Children", Type: bigquery.RecordFieldType, Schema: bigquery.Schema{
+				{Name: "a", Type: bigquery.RecordFieldType, Schema: bigquery.Schema{
+					{Name: "Name", Type: bigquery.StringFieldType},
+				}},
+			}},
+		}))
+	})
+}
+
+func TestMaxDepth(t *testing.T) {
+	row := map[string]any{
+		"a": map[string]any{
+			"b": map[string]any{
+				"c": 1,
+			},
+		},
+	}
+
+	t.Run("within max depth", func(t *testing.T) {
+		gt.R1(bqs.InferWith(row, bqs.WithMaxDepth(2))).NoError(t)
+	})
+
+	t.Run("exceed max depth", func(t *testing.T) {
+		_, err := bqs.InferWith(row, bqs.WithMaxDepth(1))
+		gt.Error(t, err).Is(bqs.ErrTooDeepNesting)
+		gt.True(t, strings.Contains(err.Error(), "'a.b'"))
+	})
+
+	t.Run("exceed default max depth", func(t *testing.T) {
+		deep := map[string]any{"v": 1}
+		for i := 0; i < 16; i++ {
+			deep = map[string]any{"nest": deep}
+		}
+		_, err := bqs.Infer(deep)
+		gt.Error(t, err).Is(bqs.ErrTooDeepNesting)
+	})
+}
+
+func TestInferType(t *testing.T) {
+	type nest struct {
+		Int int
+	}
+	type row struct {
+		Str     string
+		Any     any
+		Anys    []any
+		Map     map[string]string
+		Nest    *nest
+		Nests   []nest
+		Time    time.Time
+		Skipped string `bigquery:"-"`
+	}
+	expect := bigquery.Schema{
+		{Name: "Str", Type: bigquery.StringFieldType},
+		{Name: "Any", Type: bigquery.JSONFieldType},
+		{Name: "Anys", Type: bigquery.JSONFieldType, Repeated: true},
+		{Name: "Map", Type: bigquery.JSONFieldType},
+		{Name: "Nest", Type: bigquery.RecordFieldType, Schema: bigquery.Schema{
+			{Name: "Int", Type: bigquery.IntegerFieldType},
+		}},
+		{Name: "Nests", Type: bigquery.RecordFieldType, Repeated: true, Schema: bigquery.Schema{
+			{Name: "Int", Type: bigquery.IntegerFieldType},
+		}},
+		{Name: "Time", Type: bigquery.TimestampFieldType},
+	}
+
+	t.Run("generic", func(t *testing.T) {
+		schemas := gt.R1(bqs.InferType[row]()).NoError(t)
+		gt.True(t, bqs.Equal(schemas, expect))
+	})
+
+	t.Run("pointer type", func(t *testing.T) {
+		schemas := gt.R1(bqs.InferType[*row]()).NoError(t)
+		gt.True(t, bqs.Equal(schemas, expect))
+	})
+
+	t.Run("reflect.Type", func(t *testing.T) {
+		schemas := gt.R1(bqs.InferReflectType(reflect.TypeOf(row{}))).NoError(t)
+		gt.True(t, bqs.Equal(schemas, expect))
+	})
+
+	t.Run("with options", func(t *testing.T) {
+		type numeric struct {
+			Price *big.Rat
+		}
+		schemas := gt.R1(bqs.InferType[numeric](bqs.WithBigNumeric())).NoError(t)
+		gt.True(t, bqs.Equal(schemas, bigquery.Schema{
+			{Name: "Price", Type: bigquery.BigNumericFieldType},
+		}))
+	})
+
+	t.Run("unsupported types", func(t *testing.T) {
+		_, err := bqs.InferType[map[string]any]()
+		gt.Error(t, err).Is(bqs.ErrUnsupportedObject)
+
+		_, err = bqs.InferType[any]()
+		gt.Error(t, err).Is(bqs.ErrUnsupportedObject)
+
+		_, err = bqs.InferReflectType(nil)
+		gt.Error(t, err).Is(bqs.ErrUnsupportedObject)
+	})
+}
+
+func TestCache(t *testing.T) {
+	type static struct {
+		Str  string
+		Time time.Time
+		Nest struct {
+			Int int
+		}
+	}
+	type dynamic struct {
+		Static static
+		Any    any
+	}
+
+	t.Run("shared by InferType and InferWith", func(t *testing.T) {
+		type row struct {
+			Any any
+			M   map[string]int
+		}
+		data := row{Any: "x", M: map[string]int{"a": 1}}
+		cache := bqs.NewCache()
+
+		typed := gt.R1(bqs.InferType[row](bqs.WithCache(cache))).NoError(t)
+		gt.True(t, bqs.Equal(typed, bigquery.Schema{
+			{Name: "Any", Type: bigquery.JSONFieldType},
+			{Name: "M", Type: bigquery.JSONFieldType},
+		}))
+
+		expect := bigquery.Schema{
+			{Name: "Any", Type: bigquery.StringFieldType},
+			{Name: "M", Type: bigquery.RecordFieldType, Schema: bigquery.Schema{
+				{Name: "a", Type: bigquery.IntegerFieldType},
+			}},
+		}
+		gt.True(t, bqs.Equal(gt.R1(bqs.Infer(data)).NoError(t), expect))
+		gt.True(t, bqs.Equal(gt.R1(bqs.InferWith(data, bqs.WithCache(cache))).NoError(t), expect))
+
+		typed = gt.R1(bqs.InferType[row](bqs.WithCache(cache))).NoError(t)
+		gt.A(t, typed).At(0, func(t testing.TB, v *bigquery.FieldSchema) {
+			gt.Equal(t, v.Type, bigquery.JSONFieldType)
+		})
+	})
+
+	t.Run("shared by different options", func(t *testing.T) {
+		type row struct {
+			Price *big.Rat
+			Nest  struct {
+				Int int
+			}
+		}
+		registry := bqs.NewTypeRegistry()
+		registry.Register(reflect.TypeOf(struct{ Int int }{}), bigquery.StringFieldType)
+		cache := bqs.NewCache()
+
+		for i := 0; i < 2; i++ {
+			schema := gt.R1(bqs.InferWith(row{}, bqs.WithCache(cache))).NoError(t)
+			gt.Equal(t, schema[0].Type, bigquery.NumericFieldType)
+			gt.Equal(t, schema[1].Type, bigquery.RecordFieldType)
+
+			schema = gt.R1(bqs.InferWith(row{}, bqs.WithCache(cache), bqs.WithBigNumeric())).NoError(t)
+			gt.Equal(t, schema[0].Type, bigquery.BigNumericFieldType)
+
+			schema = gt.R1(bqs.InferWith(row{}, bqs.WithCache(cache), bqs.WithTypeRegistry(registry))).NoError(t)
+			gt.Equal(t, schema[1].Type, bigquery.StringFieldType)
+		}
+	})
+
+	t.Run("static struct", func(t *testing.T) {
+		cache := bqs.NewCache()
+		expect := gt.R1(bqs.Infer(static{})).NoError(t)
+
+		for i := 0; i < 3; i++ {
+			schemas := gt.R1(bqs.InferWith(static{}, bqs.WithCache(cache))).NoError(t)
+			gt.True(t, bqs.Equal(schemas, expect))
+
+			// modifying result must not affect cached schema
+			schemas[0].Name = "modified"
+			schemas[2].Schema[0].Type = bigquery.StringFieldType
+		}
+	})
+
+	t.Run("dynamic field is inspected every time", func(t *testing.T) {
+		cache := bqs.NewCache()
+
+		schemas := gt.R1(bqs.InferWith(dynamic{Any: "a"}, bqs.WithCache(cache))).NoError(t)
+		gt.A(t, schemas).Length(2).At(1, func(t testing.TB, v *bigquery.FieldSchema) {
+			gt.Equal(t, v.Type, bigquery.StringFieldType)
+		})
+
+		schemas = gt.R1(bqs.InferWith(dynamic{Any: 1}, bqs.WithCache(cache))).NoError(t)
+		gt.A(t, schemas).Length(2).At(1, func(t testing.TB, v *bigquery.FieldSchema) {
+			gt.Equal(t, v.Type, bigquery.IntegerFieldType)
+		})
+
+		schemas = gt.R1(bqs.InferWith(dynamic{}, bqs.WithCache(cache))).NoError(t)
+		gt.A(t, schemas).Length(1)
+	})
+
+	t.Run("recursive type is not cached", func(t *testing.T) {
+		cache := bqs.NewCache()
+		for i := 0; i < 2; i++ {
+			_, err := bqs.InferWith(recursiveNode{}, bqs.WithCache(cache))
+			gt.Error(t, err).Is(bqs.ErrRecursiveType)
+		}
+	})
+
+	t.Run("concurrent inference", func(t *testing.T) {
+		cache := bqs.NewCache()
+		expect := gt.R1(bqs.Infer(dynamic{Any: "a"})).NoError(t)
+
+		results := make([]bigquery.Schema, 16)
+		errs := make([]error, 16)
+		var wg sync.WaitGroup
+		for i := range results {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				results[i], errs[i] = bqs.InferWith(dynamic{Any: "a"}, bqs.WithCache(cache))
+			}()
+		}
+		wg.Wait()
+
+		for i := range results {
+			gt.NoError(t, errs[i])
+			gt.True(t, bqs.Equal(results[i], expect))
+		}
+	})
+}
+
+type testUUID [16]byte
+
+func (x testUUID) BigQuerySchema() *bigquery.FieldSchema {
+	return &bigquery.FieldSchema{
+		Type:        bigquery.StringFieldType,
+		Description: "UUID",
+	}
+}
+
+type testIPAddr struct {
+	addr []byte
+}
+
+func (x *testIPAddr) BigQuerySchema() *bigquery.FieldSchema {
+	return &bigquery.FieldSchema{Type: bigquery.StringFieldType}
+}
+
+type testPoint struct {
+	X, Y float64
+}
+
+func (x testPoint) BigQuerySchema() bigquery.Schema {
+	return bigquery.Schema{
+		{Name: "lat", Type: bigquery.FloatFieldType},
+		{Name: "lng", Type: bigquery.FloatFieldType},
+	}
+}
+
+func TestSchemaProvider(t *testing.T) {
+	t.Run("field schema provider", func(t *testing.T) {
+		row := struct {
+			ID    testUUID `bigquery:"id"`
+			IDs   []testUUID
+			Addr  testIPAddr
+			Addrs []*testIPAddr
+			Ptr   *testIPAddr
+		}{}
+		schemas := gt.R1(bqs.Infer(row)).NoError(t)
+		gt.True(t, bqs.Equal(schemas, bigquery.Schema{
+			{Name: "id", Type: bigquery.StringFieldType, Description: "UUID"},
+			{Name: "IDs", Type: bigquery.StringFieldType, Description: "UUID", Repeated: true},
+			{Name: "Addr", Type: bigquery.StringFieldType},
+			{Name: "Addrs", Type: bigquery.StringFieldType, Repeated: true},
+			{Name: "Ptr", Type: bigquery.StringFieldType},
+		}))
+	})
+
+	t.Run("schema provider", func(t *testing.T) {
+		row := map[string]any{
+			"point":  testPoint{},
+			"points": []testPoint{{X: 1}},
+		}
+		point := bigquery.Schema{
+			{Name: "lat", Type: bigquery.FloatFieldType},
+			{Name: "lng", Type: bigquery.FloatFieldType},
+		}
+		schemas := gt.R1(bqs.Infer(row)).NoError(t)
+		gt.True(t, bqs.Equal(schemas, bigquery.Schema{
+			{Name: "point", Type: bigquery.RecordFieldType, Schema: point},
+			{Name: "points", Type: bigquery.RecordFieldType, Repeated: true, Schema: point},
+		}))
+	})
+
+	t.Run("top level schema provider", func(t *testing.T) {
+		schemas := gt.R1(bqs.Infer(&testPoint{})).NoError(t)
+		gt.A(t, schemas).Length(2)
+		gt.Equal(t, schemas[0].Name, "lat")
+	})
+
+	t.Run("type only inference", func(t *testing.T) {
+		type row struct {
+			ID    testUUID
+			Point testPoint
+		}
+		schemas := gt.R1(bqs.InferType[row]()).NoError(t)
+		gt.A(t, schemas).Length(2).At(0, func(t testing.TB, v *bigquery.FieldSchema) {
+			gt.Equal(t, v.Type, bigquery.StringFieldType)
+		}).At(1, func(t testing.TB, v *bigquery.FieldSchema) {
+			gt.Equal(t, v.Type, bigquery.RecordFieldType)
+			gt.A(t, v.Schema).Length(2)
+		})
+	})
+}
+
+type testEnum int
+
+func (x testEnum) MarshalText() ([]byte, error) {
+	return []byte("enum"), nil
+}
+
+type testJSONMarshaler struct {
+	Value int
+}
+
+func (x *testJSONMarshaler) MarshalJSON() ([]byte, error) {
+	return json.Marshal(map[string]any{"value": x.Value, "label": "x"})
+}
+
+func TestMarshaledForm(t *testing.T) {
+	row := struct {
+		IP      net.IP
+		Addr    netip.Addr
+		Enum    testEnum
+		Enums   []testEnum
+		Custom  testJSONMarshaler
+		Ptr     *testJSONMarshaler
+		Time    time.Time
+		Date    civil.Date
+		Price   *big.Rat
+		Raw     json.RawMessage
+		NullStr bigquery.NullString
+	}{
+		IP:   net.ParseIP("192.0.2.1"),
+		Addr: netip.MustParseAddr("192.0.2.1"),
+	}
+
+	t.Run("without option", func(t *testing.T) {
+		schemas := gt.R1(bqs.Infer(row)).NoError(t)
+		types := map[string]bigquery.FieldType{}
+		for _, field := range schemas {
+			types[field.Name] = field.Type
+		}
+		gt.Equal(t, types["IP"], bigquery.BytesFieldType)
+		gt.Equal(t, types["Enum"], bigquery.IntegerFieldType)
+	})
+
+	t.Run("with option", func(t *testing.T) {
+		custom := bigquery.Schema{
+			{Name: "label", Type: bigquery.StringFieldType},
+			{Name: "value", Type: bigquery.IntegerFieldType},
+		}
+		schemas := gt.R1(bqs.InferWith(row, bqs.WithMarshaledForm())).NoError(t)
+		gt.True(t, bqs.Equal(schemas, bigquery.Schema{
+			{Name: "IP", Type: bigquery.StringFieldType},
+			{Name: "Addr", Type: bigquery.StringFieldType},
+			{Name: "Enum", Type: bigquery.StringFieldType},
+			{Name: "Enums", Type: bigquery.StringFieldType, Repeated: true},
+			{Name: "Custom", Type: bigquery.RecordFieldType, Schema: custom},
+			{Name: "Ptr", Type: bigquery.RecordFieldType, Schema: custom},
+			{Name: "Time", Type: bigquery.TimestampFieldType},
+			{Name: "Date", Type: bigquery.DateFieldType},
+			{Name: "Price", Type: bigquery.NumericFieldType},
+			{Name: "Raw", Type: bigquery.JSONFieldType},
+			{Name: "NullStr", Type: bigquery.StringFieldType},
+		}))
+	})
+}
+
+type testGeometry struct {
+	X, Y float64
+}
+
+type testObjectID [12]byte
+
+type testGlobalID struct {
+	Value string
+}
+
+func init() {
+	bqs.RegisterType(reflect.TypeOf(testGlobalID{}), bigquery.StringFieldType)
+}
+
+func TestTypeRegistry(t *testing.T) {
+	type row struct {
+		Geo     testGeometry
+		Geos    []testGeometry
+		GeoPtr  *testGeometry
+		ID      testObjectID
+		Global  testGlobalID
+		Point   testPoint
+		Tagged  testGeometry `bigquery:",json"`
+		Created time.Time
+	}
+	data := row{Geos: []testGeometry{{X: 1, Y: 2}}}
+
+	registry := bqs.NewTypeRegistry()
+	registry.Register(reflect.TypeOf(testGeometry{}), bigquery.GeographyFieldType)
+	registry.Register(reflect.TypeOf(testPoint{}), bigquery.StringFieldType)
+	registry.RegisterFunc(func(t reflect.Type) (bigquery.FieldType, bool) {
+		if t.Kind() == reflect.Array && t.Elem().Kind() == reflect.Uint8 && t.Len() == 12 {
+			return bigquery.StringFieldType, true
+		}
+		return "", false
+	})
+
+	expected := bigquery.Schema{
+		{Name: "Geo", Type: bigquery.GeographyFieldType},
+		{Name: "Geos", Type: bigquery.GeographyFieldType, Repeated: true},
+		{Name: "GeoPtr", Type: bigquery.GeographyFieldType},
+		{Name: "ID", Type: bigquery.StringFieldType},
+		{Name: "Global", Type: bigquery.StringFieldType},
+		{Name: "Point", Type: bigquery.StringFieldType},
+		{Name: "Tagged", Type: bigquery.JSONFieldType},
+		{Name: "Created", Type: bigquery.TimestampFieldType},
+	}
+
+	t.Run("infer with registry", func(t *testing.T) {
+		schema := gt.R1(bqs.InferWith(data, bqs.WithTypeRegistry(registry))).NoError(t)
+		gt.True(t, bqs.Equal(schema, expected))
+	})
+
+	t.Run("infer type with registry", func(t *testing.T) {
+		schema := gt.R1(bqs.InferType[row](bqs.WithTypeRegistry(registry))).NoError(t)
+		gt.True(t, bqs.Equal(schema, expected))
+	})
+
+	t.Run("infer with cache", func(t *testing.T) {
+		cache := bqs.NewCache()
+		for i := 0; i < 2; i++ {
+			schema := gt.R1(bqs.InferWith(data, bqs.WithTypeRegistry(registry), bqs.WithCache(cache))).NoError(t)
+			gt.True(t, bqs.Equal(schema, expected))
+		}
+	})
+
+	t.Run("per-call registry takes precedence over global one", func(t *testing.T) {
+		override := bqs.NewTypeRegistry()
+		override.Register(reflect.TypeOf(testGlobalID{}), bigquery.BytesFieldType)
+		schema := gt.R1(bqs.InferWith(struct{ ID testGlobalID }{}, bqs.WithTypeRegistry(override))).NoError(t)
+		gt.A(t, schema).Length(1).At(0, func(t testing.TB, v *bigquery.FieldSchema) {
+			gt.Equal(t, v.Type, bigquery.BytesFieldType)
+		})
+	})
+
+	t.Run("without registry", func(t *testing.T) {
+		schema := gt.R1(bqs.Infer(struct {
+			Geo    testGeometry
+			Global testGlobalID
+		}{})).NoError(t)
+		gt.A(t, schema).Length(2).At(0, func(t testing.TB, v *bigquery.FieldSchema) {
+			gt.Equal(t, v.Type, bigquery.RecordFieldType)
+		}).At(1, func(t testing.TB, v *bigquery.FieldSchema) {
+			gt.Equal(t, v.Type, bigquery.StringFieldType)
+		})
+	})
+}
+
+func TestDuration(t *testing.T) {
+	type row struct {
+		Timeout   time.Duration
+		Intervals []time.Duration
+		Optional  *time.Duration
+		Count     int64
+	}
+
+	testCases := map[string]struct {
+		options     []bqs.InferOption
+		fieldType   bigquery.FieldType
+		description string
+	}{
+		"default": {
+			fieldType: bigquery.IntegerFieldType,
+		},
+		"as integer": {
+			options:   []bqs.InferOption{bqs.WithDuration(bqs.DurationAsInteger)},
+			fieldType: bigquery.IntegerFieldType,
+		},
+		"as interval": {
+			options:   []bqs.InferOption{bqs.WithDuration(bqs.DurationAsInterval)},
+			fieldType: bigquery.IntervalFieldType,
+		},
+		"as nanoseconds": {
+			options:     []bqs.InferOption{bqs.WithDuration(bqs.DurationAsNanoseconds)},
+			fieldType:   bigquery.IntegerFieldType,
+			description: "duration in nanoseconds",
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			schema := gt.R1(bqs.InferWith(row{Intervals: []time.Duration{time.Second}}, tc.options...)).NoError(t)
+			gt.A(t, schema).Length(4).
+				At(0, func(t testing.TB, v *bigquery.FieldSchema) {
+					gt.Equal(t, v.Type, tc.fieldType)
+					gt.Equal(t, v.Description, tc.description)
+				}).
+				At(1, func(t testing.TB, v *bigquery.FieldSchema) {
+					gt.Equal(t, v.Type, tc.fieldType)
+					gt.Equal(t, v.Repeated, true)
+				}).
+				At(2, func(t testing.TB, v *bigquery.FieldSchema) {
+					gt.Equal(t, v.Type, tc.fieldType)
+				}).
+				At(3, func(t testing.TB, v *bigquery.FieldSchema) {
+					gt.Equal(t, v.Type, bigquery.IntegerFieldType)
+					gt.Equal(t, v.Description, "")
+				})
+		})
+	}
+}
+
+func TestDetectInterval(t *testing.T) {
+	testCases := map[string]bool{
+		"P1Y2M3DT4H5M6S": true,
+		"PT1H30M":        true,
+		"PT0.5S":         true,
+		"P2W":            true,
+		"-P1D":           true,
+		"P":              false,
+		"PT":             false,
+		"P1DT":           false,
+		"1h30m":          false,
+		"PT1.5M":         false,
+		"Paris":          false,
+		"":               false,
+	}
+
+	for input, expected := range testCases {
+		t.Run(input, func(t *testing.T) {
+			fieldType, ok := bqs.DetectInterval(input)
+			gt.Equal(t, ok, expected)
+			if expected {
+				gt.Equal(t, fieldType, bigquery.IntervalFieldType)
+			}
+		})
+	}
+
+	t.Run("infer with detector", func(t *testing.T) {
+		data := map[string]any{
+			"elapsed": "PT1H30M",
+			"name":    "PT",
+			"steps":   []any{"PT1S", "PT2S"},
+		}
+		schema := gt.R1(bqs.InferWith(data, bqs.WithStringDetector(bqs.DetectInterval))).NoError(t)
+		gt.True(t, bqs.Equal(schema, bigquery.Schema{
+			{Name: "elapsed", Type: bigquery.IntervalFieldType},
+			{Name: "name", Type: bigquery.StringFieldType},
+			{Name: "steps", Type: bigquery.IntervalFieldType, Repeated: true},
+		}))
+
+		schema = gt.R1(bqs.Infer(data)).NoError(t)
+		gt.A(t, schema).At(0, func(t testing.TB, v *bigquery.FieldSchema) {
+			gt.Equal(t, v.Type, bigquery.StringFieldType)
+		})
+	})
+}
+
+func TestStringDetector(t *testing.T) {
+	testCases := map[string]struct {
+		detector bqs.StringDetector
+		input    string
+		expected bigquery.FieldType
+	}{
+		"timestamp":                  {bqs.DetectTimestamp, "2024-01-02T03:04:05Z", bigquery.TimestampFieldType},
+		"timestamp with fraction":    {bqs.DetectTimestamp, "2024-01-02T03:04:05.123456+09:00", bigquery.TimestampFieldType},
+		"timestamp with space":       {bqs.DetectTimestamp, "2024-01-02 03:04:05-07:00", bigquery.TimestampFieldType},
+		"timestamp without zone":     {bqs.DetectTimestamp, "2024-01-02T03:04:05", ""},
+		"timestamp of date":          {bqs.DetectTimestamp, "2024-01-02", ""},
+		"datetime":                   {bqs.DetectDateTime, "2024-01-02T03:04:05", bigquery.DateTimeFieldType},
+		"datetime with space":        {bqs.DetectDateTime, "2024-01-02 03:04:05.5", bigquery.DateTimeFieldType},
+		"datetime with zone":         {bqs.DetectDateTime, "2024-01-02T03:04:05Z", ""},
+		"date":                       {bqs.DetectDate, "2024-01-02", bigquery.DateFieldType},
+		"invalid date":               {bqs.DetectDate, "2024-13-02", ""},
+		"time":                       {bqs.DetectTime, "03:04:05", bigquery.TimeFieldType},
+		"time with fraction":         {bqs.DetectTime, "23:59:59.999", bigquery.TimeFieldType},
+		"time without seconds":       {bqs.DetectTime, "03:04", ""},
+		"integer":                    {bqs.DetectNumber, "-123", bigquery.IntegerFieldType},
+		"float":                      {bqs.DetectNumber, "1.5", bigquery.FloatFieldType},
+		"exponent":                   {bqs.DetectNumber, "1e10", bigquery.FloatFieldType},
+		"integer out of range":       {bqs.DetectNumber, "12345678901234567890", bigquery.FloatFieldType},
+		"not a number":               {bqs.DetectNumber, "NaN", ""},
+		"hexadecimal":                {bqs.DetectNumber, "0x10", ""},
+		"empty":                      {bqs.DetectNumber, "", ""},
+		"plain string for timestamp": {bqs.DetectTimestamp, "blue", ""},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			fieldType, ok := tc.detector(tc.input)
+			gt.Equal(t, ok, tc.expected != "")
+			gt.Equal(t, fieldType, tc.expected)
+		})
+	}
+
+	t.Run("infer with default detectors", func(t *testing.T) {
+		var data map[string]any
+		gt.NoError(t, json.Unmarshal([]byte(`{
+			"created_at": "2024-01-02T03:04:05Z",
+			"local": "2024-01-02 03:04:05",
+			"birthday": "2000-01-02",
+			"alarm": "07:30:00",
+			"zip": "01234",
+			"name": "blue"
+		}`), &data))
+
+		schema := gt.R1(bqs.InferWith(data, bqs.WithStringDetector(bqs.DefaultStringDetectors()...))).NoError(t)
+		gt.True(t, bqs.Equal(schema, bigquery.Schema{
+			{Name: "alarm", Type: bigquery.TimeFieldType},
+			{Name: "birthday", Type: bigquery.DateFieldType},
+			{Name: "created_at", Type: bigquery.TimestampFieldType},
+			{Name: "local", Type: bigquery.DateTimeFieldType},
+			{Name: "name", Type: bigquery.StringFieldType},
+			{Name: "zip", Type: bigquery.StringFieldType},
+		}))
+
+		schema = gt.R1(bqs.InferWith(data,
+			bqs.WithStringDetector(bqs.DefaultStringDetectors()...),
+			bqs.WithStringDetector(bqs.DetectNumber),
+		)).NoError(t)
+		gt.A(t, schema).At(5, func(t testing.TB, v *bigquery.FieldSchema) {
+			gt.Equal(t, v.Name, "zip")
+			gt.Equal(t, v.Type, bigquery.IntegerFieldType)
+		})
+	})
+
+	t.Run("detected and plain strings in the same column", func(t *testing.T) {
+		options := []bqs.InferOption{bqs.WithStringDetector(bqs.DefaultStringDetectors()...)}
+
+		var resolutions []bqs.Resolution
+		schema := gt.R1(bqs.InferWith(map[string]any{
+			"a": []any{"2024-01-02", "foo"},
+		}, append(options, bqs.WithInferHook(func(r bqs.Resolution) {
+			resolutions = append(resolutions, r)
+		}))...)).NoError(t)
+		gt.True(t, bqs.Equal(schema, bigquery.Schema{
+			{Name: "a", Type: bigquery.StringFieldType, Repeated: true},
+		}))
+		gt.A(t, resolutions).Length(1).At(0, func(t testing.TB, v bqs.Resolution) {
+			gt.Equal(t, v.String(), "widen: field='a' (old=DATE, new=STRING, resolved=STRING)")
+		})
+
+		// types of different kinds are still conflicted
+		_, err := bqs.InferWith(map[string]any{"a": []any{"2024-01-02", true}}, options...)
+		gt.Error(t, err).Is(bqs.ErrConflictField)
+
+		// across rows
+		var merged bigquery.Schema
+		for _, row := range []map[string]any{
+			{"t": "2024-01-02T03:04:05Z"},
+			{"t": "unknown"},
+		} {
+			inferred := gt.R1(bqs.InferWith(row, options...)).NoError(t)
+			merged = gt.R1(bqs.MergeWith(merged, inferred, bqs.WithWidening(bqs.WidenWithString))).NoError(t)
+		}
+		gt.True(t, bqs.Equal(merged, bigquery.Schema{
+			{Name: "t", Type: bigquery.StringFieldType},
+		}))
+	})
+
+	t.Run("struct field with cache", func(t *testing.T) {
+		type row struct {
+			CreatedAt string
+		}
+		cache := bqs.NewCache()
+		options := []bqs.InferOption{bqs.WithCache(cache), bqs.WithStringDetector(bqs.DetectTimestamp)}
+
+		schema := gt.R1(bqs.InferWith(row{CreatedAt: "2024-01-02T03:04:05Z"}, options...)).NoError(t)
+		gt.A(t, schema).At(0, func(t testing.TB, v *bigquery.FieldSchema) {
+			gt.Equal(t, v.Type, bigquery.TimestampFieldType)
+		})
+		schema = gt.R1(bqs.InferWith(row{CreatedAt: "blue"}, options...)).NoError(t)
+		gt.A(t, schema).At(0, func(t testing.TB, v *bigquery.FieldSchema) {
+			gt.Equal(t, v.Type, bigquery.StringFieldType)
+		})
+	})
+}
+
+func TestJSONNumber(t *testing.T) {
+	decoder := json.NewDecoder(strings.NewReader(`{
+		"count": 5,
+		"ratio": 0.5,
+		"exp": 1e3,
+		"huge": 12345678901234567890,
+		"values": [1, 2.5, 3],
+		"ids": [1, 2],
+		"points": [{"x": 1}, {"x": 1.5, "y": 2}],
+		"mixed": [1, "a"]
+	}`))
+	decoder.UseNumber()
+	var data map[string]any
+	gt.NoError(t, decoder.Decode(&data))
+
+	_, err := bqs.Infer(data)
+	gt.Error(t, err).Is(bqs.ErrConflictField)
+
+	delete(data, "mixed")
+	schema := gt.R1(bqs.Infer(data)).NoError(t)
+	gt.True(t, bqs.Equal(schema, bigquery.Schema{
+		{Name: "count", Type: bigquery.IntegerFieldType},
+		{Name: "exp", Type: bigquery.FloatFieldType},
+		{Name: "huge", Type: bigquery.FloatFieldType},
+		{Name: "ids", Type: bigquery.IntegerFieldType, Repeated: true},
+		{
+			Name:     "points",
+			Type:     bigquery.RecordFieldType,
+			Repeated: true,
+			Schema: bigquery.Schema{
+				{Name: "x", Type: bigquery.FloatFieldType},
+				{Name: "y", Type: bigquery.IntegerFieldType},
+			},
+		},
+		{Name: "ratio", Type: bigquery.FloatFieldType},
+		{Name: "values", Type: bigquery.FloatFieldType, Repeated: true},
+	}))
+
+	t.Run("struct field with cache", func(t *testing.T) {
+		type row struct {
+			Value json.Number
+		}
+		cache := bqs.NewCache()
+		schema := gt.R1(bqs.InferWith(row{Value: "1"}, bqs.WithCache(cache))).NoError(t)
+		gt.A(t, schema).At(0, func(t testing.TB, v *bigquery.FieldSchema) {
+			gt.Equal(t, v.Type, bigquery.IntegerFieldType)
+		})
+		schema = gt.R1(bqs.InferWith(row{Value: "1.5"}, bqs.WithCache(cache))).NoError(t)
+		gt.A(t, schema).At(0, func(t testing.TB, v *bigquery.FieldSchema) {
+			gt.Equal(t, v.Type, bigquery.FloatFieldType)
+		})
+	})
+}
+
+func TestArrayConflict(t *testing.T) {
+	decoder := json.NewDecoder(strings.NewReader(`{
+		"numbers": [1, 2.5],
+		"mixed": [1, 2.5, "a", true],
+		"objects": [{"x": 1}, {"x": "a"}],
+		"object_and_string": [{"x": 1}, "s"],
+		"nested": [[1], 2]
+	}`))
+	decoder.UseNumber()
+	var data map[string]any
+	gt.NoError(t, decoder.Decode(&data))
+
+	pick := func(keys ...string) map[string]any {
+		picked := map[string]any{}
+		for _, key := range keys {
+			picked[key] = data[key]
+		}
+		return picked
+	}
+
+	t.Run("fail by default", func(t *testing.T) {
+		for _, key := range []string{"mixed", "objects", "object_and_string", "nested"} {
+			_, err := bqs.Infer(pick(key))
+			gt.Error(t, err).Is(bqs.ErrConflictField)
+		}
+
+		var resolutions []bqs.Resolution
+		schema := gt.R1(bqs.InferWith(pick("numbers"), bqs.WithInferHook(func(r bqs.Resolution) {
+			resolutions = append(resolutions, r)
+		}))).NoError(t)
+		gt.True(t, bqs.Equal(schema, bigquery.Schema{
+			{Name: "numbers", Type: bigquery.FloatFieldType, Repeated: true},
+		}))
+		gt.A(t, resolutions).Length(1).At(0, func(t testing.TB, v bqs.Resolution) {
+			gt.Equal(t, v.Kind, bqs.ResolutionWiden)
+			gt.Equal(t, v.Path, "numbers")
+			gt.Equal(t, v.Resolved, bigquery.FloatFieldType)
+		})
+	})
+
+	t.Run("widen", func(t *testing.T) {
+		var resolutions []bqs.Resolution
+		schema := gt.R1(bqs.InferWith(pick("numbers", "mixed", "objects"),
+			bqs.WithArrayConflict(bqs.ArrayConflictWiden),
+			bqs.WithInferHook(func(r bqs.Resolution) {
+				resolutions = append(resolutions, r)
+			}),
+		)).NoError(t)
+		gt.True(t, bqs.Equal(schema, bigquery.Schema{
+			{Name: "mixed", Type: bigquery.StringFieldType, Repeated: true},
+			{Name: "numbers", Type: bigquery.FloatFieldType, Repeated: true},
+			{
+				Name:     "objects",
+				Type:     bigquery.RecordFieldType,
+				Repeated: true,
+				Schema: bigquery.Schema{
+					{Name: "x", Type: bigquery.StringFieldType},
+				},
+			},
+		}))
+		gt.A(t, resolutions).Length(5).At(0, func(t testing.TB, v bqs.Resolution) {
+			gt.Equal(t, v.Path, "mixed")
+			gt.Equal(t, v.Old, bigquery.IntegerFieldType)
+			gt.Equal(t, v.New, bigquery.FloatFieldType)
+			gt.Equal(t, v.Resolved, bigquery.FloatFieldType)
+		}).At(1, func(t testing.TB, v bqs.Resolution) {
+			gt.Equal(t, v.Path, "mixed")
+			gt.Equal(t, v.Old, bigquery.FloatFieldType)
+			gt.Equal(t, v.New, bigquery.StringFieldType)
+			gt.Equal(t, v.Resolved, bigquery.StringFieldType)
+		}).At(4, func(t testing.TB, v bqs.Resolution) {
+			gt.Equal(t, v.Path, "objects.x")
+			gt.Equal(t, v.Resolved, bigquery.StringFieldType)
+		})
+
+		for _, key := range []string{"object_and_string", "nested"} {
+			_, err := bqs.InferWith(pick(key), bqs.WithArrayConflict(bqs.ArrayConflictWiden))
+			gt.Error(t, err).Is(bqs.ErrConflictField)
+		}
+	})
+
+	t.Run("json", func(t *testing.T) {
+		var resolutions []bqs.Resolution
+		schema := gt.R1(bqs.InferWith(data,
+			bqs.WithArrayConflict(bqs.ArrayConflictJSON),
+			bqs.WithInferHook(func(r bqs.Resolution) {
+				resolutions = append(resolutions, r)
+			}),
+		)).NoError(t)
+		gt.True(t, bqs.Equal(schema, bigquery.Schema{
+			{Name: "mixed", Type: bigquery.JSONFieldType},
+			{Name: "nested", Type: bigquery.JSONFieldType},
+			{Name: "numbers", Type: bigquery.FloatFieldType, Repeated: true},
+			{Name: "object_and_string", Type: bigquery.JSONFieldType},
+			{Name: "objects", Type: bigquery.JSONFieldType},
+		}))
+
+		var paths []string
+		for _, r := range resolutions {
+			if r.Kind == bqs.ResolutionJSON {
+				paths = append(paths, r.Path)
+			}
+		}
+		gt.A(t, paths).Length(4)
+	})
+
+	t.Run("path of nested field", func(t *testing.T) {
+		var resolutions []bqs.Resolution
+		_ = gt.R1(bqs.InferWith(map[string]any{
+			"user": map[string]any{"tags": []any{1, "a"}},
+		}, bqs.WithArrayConflict(bqs.ArrayConflictWiden), bqs.WithInferHook(func(r bqs.Resolution) {
+			resolutions = append(resolutions, r)
+		}))).NoError(t)
+		gt.A(t, resolutions).Length(1).At(0, func(t testing.TB, v bqs.Resolution) {
+			gt.Equal(t, v.Path, "user.tags")
+			gt.Equal(t, v.String(), "widen: field='user.tags' (old=INTEGER, new=STRING, resolved=STRING)")
+		})
+	})
+}
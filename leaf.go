@@ -0,0 +1,81 @@
+package bqs
+
+import (
+	"database/sql"
+	"encoding/json"
+	"math/big"
+	"reflect"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"cloud.google.com/go/civil"
+)
+
+// leafTypes is a list of struct types that should be inferred as a single column instead of RECORD. It is same mapping as the BigQuery client library, including NullXxx wrapper types.
+var leafTypes = []struct {
+	goType    reflect.Type
+	fieldType bigquery.FieldType
+}{
+	{reflect.TypeOf(time.Time{}), bigquery.TimestampFieldType},
+	{reflect.TypeOf(civil.Date{}), bigquery.DateFieldType},
+	{reflect.TypeOf(civil.Time{}), bigquery.TimeFieldType},
+	{reflect.TypeOf(civil.DateTime{}), bigquery.DateTimeFieldType},
+	{reflect.TypeOf(big.Rat{}), bigquery.NumericFieldType},
+
+	// Nullable types of BigQuery client library
+	{reflect.TypeOf(bigquery.NullString{}), bigquery.StringFieldType},
+	{reflect.TypeOf(bigquery.NullInt64{}), bigquery.IntegerFieldType},
+	{reflect.TypeOf(bigquery.NullFloat64{}), bigquery.FloatFieldType},
+	{reflect.TypeOf(bigquery.NullBool{}), bigquery.BooleanFieldType},
+	{reflect.TypeOf(bigquery.NullTimestamp{}), bigquery.TimestampFieldType},
+	{reflect.TypeOf(bigquery.NullDate{}), bigquery.DateFieldType},
+	{reflect.TypeOf(bigquery.NullTime{}), bigquery.TimeFieldType},
+	{reflect.TypeOf(bigquery.NullDateTime{}), bigquery.DateTimeFieldType},
+	{reflect.TypeOf(bigquery.NullGeography{}), bigquery.GeographyFieldType},
+	{reflect.TypeOf(bigquery.NullJSON{}), bigquery.JSONFieldType},
+
+	// Nullable types of database/sql. sql.Null[T] is handled by isSQLNullType because it is generic.
+	{reflect.TypeOf(sql.NullString{}), bigquery.StringFieldType},
+	{reflect.TypeOf(sql.NullInt64{}), bigquery.IntegerFieldType},
+	{reflect.TypeOf(sql.NullInt32{}), bigquery.IntegerFieldType},
+	{reflect.TypeOf(sql.NullInt16{}), bigquery.IntegerFieldType},
+	{reflect.TypeOf(sql.NullByte{}), bigquery.IntegerFieldType},
+	{reflect.TypeOf(sql.NullFloat64{}), bigquery.FloatFieldType},
+	{reflect.TypeOf(sql.NullBool{}), bigquery.BooleanFieldType},
+	{reflect.TypeOf(sql.NullTime{}), bigquery.TimestampFieldType},
+}
+
+// lookupLeafType returns BigQuery field type of the struct type if the type is one of leafTypes or a named type defined by it, such as `type MyDate civil.Date`. An unnamed struct that has the same fields, such as `struct{ String string; Valid bool }`, is not a leaf type.
+func lookupLeafType(t reflect.Type) (bigquery.FieldType, bool) {
+	for _, leaf := range leafTypes {
+		if t == leaf.goType {
+			return leaf.fieldType, true
+		}
+	}
+
+	// a named struct type is convertible to a leaf type only if their underlying types are identical. Note that a named struct declared with exactly the same fields can not be distinguished from the definition by reflection.
+	if t.Name() == "" || t.Kind() != reflect.Struct {
+		return "", false
+	}
+	for _, leaf := range leafTypes {
+		if t.ConvertibleTo(leaf.goType) {
+			return leaf.fieldType, true
+		}
+	}
+	return "", false
+}
+
+// durationType is time.Duration that is inferred by DurationMode.
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// jsonNumberType is json.Number that is inferred as INTEGER or FLOAT by the value.
+var jsonNumberType = reflect.TypeOf(json.Number(""))
+
+// rawMessageType is the type of json.RawMessage. It must be compared strictly because []byte is also convertible to json.RawMessage.
+var rawMessageType = reflect.TypeOf(json.RawMessage{})
+
+// isSQLNullType returns true if the type is sql.Null[T]. The value of sql.Null[T] is stored in the field V.
+func isSQLNullType(t reflect.Type) bool {
+	return t.Kind() == reflect.Struct && t.PkgPath() == "database/sql" && strings.HasPrefix(t.Name(), "Null[")
+}
@@ -0,0 +1,85 @@
+package bqs
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"reflect"
+
+	"cloud.google.com/go/bigquery"
+)
+
+var (
+	jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+// WithMarshaledForm makes a type that implements json.Marshaler or encoding.TextMarshaler be inferred from the marshaled form, such as net.IP and uuid.UUID. A type implementing encoding.TextMarshaler is inferred as STRING, and output of json.Marshaler is decoded and inferred again. json.Marshaler takes precedence as encoding/json does. Types that have dedicated mapping, such as time.Time, civil types and big.Rat, are not affected.
+func WithMarshaledForm() InferOption {
+	return func(cfg *inferConfig) {
+		cfg.marshaledForm = true
+	}
+}
+
+// isMarshalerType returns true if the type or pointer of the type implements json.Marshaler or encoding.TextMarshaler, and the type has no dedicated mapping.
+func isMarshalerType(t reflect.Type) bool {
+	if hasDedicatedMapping(t) {
+		return false
+	}
+	for _, it := range []reflect.Type{jsonMarshalerType, textMarshalerType} {
+		if t.Implements(it) || reflect.PointerTo(t).Implements(it) {
+			return true
+		}
+	}
+	return false
+}
+
+// hasDedicatedMapping returns true if bqs maps the type to a specific field type even if it implements marshaler interfaces.
+func hasDedicatedMapping(t reflect.Type) bool {
+	if t == rawMessageType || isSQLNullType(t) {
+		return true
+	}
+	if t.Kind() == reflect.Struct {
+		_, ok := lookupLeafType(t)
+		return ok
+	}
+	return false
+}
+
+// inferMarshaled infers the field from marshaled form of the data. The second return value is false if the data implements neither json.Marshaler nor encoding.TextMarshaler.
+func inferMarshaled(cfg *inferConfig, name string, data reflect.Value) (*bigquery.FieldSchema, bool, error) {
+	if hasDedicatedMapping(data.Type()) {
+		return nil, false, nil
+	}
+
+	if v, ok := implementerOf(data, jsonMarshalerType); ok {
+		raw, err := v.(json.Marshaler).MarshalJSON()
+		if err != nil {
+			return nil, true, fmt.Errorf("failed to marshal JSON of field '%s': %w", cfg.fieldPath(name), err)
+		}
+
+		// decode numbers as json.Number to distinguish INTEGER from FLOAT
+		decoder := json.NewDecoder(bytes.NewReader(raw))
+		decoder.UseNumber()
+		var decoded any
+		if err := decoder.Decode(&decoded); err != nil {
+			return nil, true, fmt.Errorf("failed to decode marshaled JSON of field '%s': %w", cfg.fieldPath(name), err)
+		}
+		if decoded == nil {
+			return nil, true, nil
+		}
+
+		field, err := inferField(cfg, name, reflect.ValueOf(decoded))
+		return field, true, err
+	}
+
+	if _, ok := implementerOf(data, textMarshalerType); ok {
+		return &bigquery.FieldSchema{
+			Name: name,
+			Type: bigquery.StringFieldType,
+		}, true, nil
+	}
+
+	return nil, false, nil
+}
@@ -1,7 +1,9 @@
 package bqs
 
 import (
+	"errors"
 	"fmt"
+	"sort"
 	"strings"
 
 	"cloud.google.com/go/bigquery"
@@ -13,46 +15,97 @@ import (
 // If the field Name is found in the old schema, it will be replaced with the new field.
 // If the field Type, Repeated, Required is different, it will return an error.
 // In other cases, old field will be overwritten by new field.
+// Fields of the result are ordered by OrderNewFirst policy. Use MergeWith to change the policy.
 func Merge(old, new bigquery.Schema) (bigquery.Schema, error) {
-	return merge("", old, new)
+	return MergeWith(old, new)
 }
 
-func merge(path string, old, new bigquery.Schema) (bigquery.Schema, error) {
-	var result bigquery.Schema
-
-	oldFields := make(map[string]*bigquery.FieldSchema)
-	for _, p := range old {
-		oldFields[p.Name] = p
+// MergeWith merges two bigquery.Schema with options and returns a new bigquery.Schema. Merge is a shortcut of MergeWith without any option.
+func MergeWith(old, new bigquery.Schema, options ...MergeOption) (bigquery.Schema, error) {
+	cfg := newMergeConfig(options...)
+	merged, err := merge(cfg, "", old, new)
+	if err != nil {
+		return nil, err
+	}
+	if len(cfg.conflicts) > 0 {
+		return nil, errors.Join(cfg.conflicts...)
 	}
+	return merged, nil
+}
+
+func merge(cfg *mergeConfig, path string, old, new bigquery.Schema) (bigquery.Schema, error) {
+	// mergedFields has merged fields that exist in both old and new schema. The key is the field name in the old schema.
+	mergedFields := make(map[string]*bigquery.FieldSchema)
+	var newOrder, added bigquery.Schema
 
 	for _, p := range new {
 		exist, err := lookupField(old, path, p.Name)
 		if err != nil {
-			return nil, err
+			if err := cfg.conflict(err); err != nil {
+				return nil, err
+			}
+			continue
 		}
 		if exist == nil {
-			result = append(result, p)
+			newOrder = append(newOrder, p)
+			added = append(added, p)
 			continue
 		}
-		delete(oldFields, p.Name)
 
-		merged, err := mergeField(path, exist, p)
+		merged, err := mergeField(cfg, path, exist, p)
 		if err != nil {
 			return nil, err
 		}
 
-		if merged != nil {
-			result = append(result, merged)
-		}
+		mergedFields[exist.Name] = merged
+		newOrder = append(newOrder, merged)
 	}
 
-	for _, p := range oldFields {
-		result = append(result, p)
+	var result bigquery.Schema
+	switch cfg.order {
+	case OrderOldFirst:
+		for _, p := range old {
+			if merged, ok := mergedFields[p.Name]; ok {
+				result = append(result, merged)
+			} else {
+				result = append(result, p)
+			}
+		}
+		result = append(result, added...)
+
+	default:
+		result = newOrder
+		for _, p := range old {
+			if _, ok := mergedFields[p.Name]; !ok {
+				result = append(result, p)
+			}
+		}
+		if cfg.order == OrderByName {
+			// nested fields of added and not merged fields are in the order of the source schema, then they are sorted as well
+			result = sortByName(result)
+		}
 	}
 
 	return result, nil
 }
 
+// sortByName returns a copy of the schema whose fields, including nested fields of RECORD, are sorted by name.
+func sortByName(schema bigquery.Schema) bigquery.Schema {
+	sorted := make(bigquery.Schema, len(schema))
+	for i, field := range schema {
+		if field.Schema != nil {
+			copied := *field
+			copied.Schema = sortByName(field.Schema)
+			field = &copied
+		}
+		sorted[i] = field
+	}
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Name < sorted[j].Name
+	})
+	return sorted
+}
+
 func lookupField(s bigquery.Schema, path, name string) (*bigquery.FieldSchema, error) {
 	var result *bigquery.FieldSchema
 	for i, p := range s {
@@ -76,25 +129,68 @@ func boolToStr(b bool) string {
 	return "false"
 }
 
-func mergeField(path string, old, new *bigquery.FieldSchema) (*bigquery.FieldSchema, error) {
+func mergeField(cfg *mergeConfig, path string, old, new *bigquery.FieldSchema) (*bigquery.FieldSchema, error) {
 	merged := *new
 	if old.Type != new.Type {
-		return nil, fmt.Errorf("type conflict: field='%s%s' (old=%s, new=%s): %w", path, old.Name, old.Type, new.Type, ErrConflictField)
+		if widened, ok := cfg.widen(old.Type, new.Type); ok {
+			kind := ResolutionWiden
+			if widened == bigquery.JSONFieldType {
+				kind = ResolutionJSON
+			}
+			cfg.report(Resolution{
+				Kind:     kind,
+				Path:     path + old.Name,
+				Old:      old.Type,
+				New:      new.Type,
+				Resolved: widened,
+			})
+			merged.Type = widened
+			widenParameters(&merged, old, new)
+		} else if err := cfg.conflict(fmt.Errorf("type conflict: field='%s%s' (old=%s, new=%s): %w", path, old.Name, old.Type, new.Type, ErrConflictField)); err != nil {
+			return nil, err
+		}
 	}
 
 	if old.Repeated != new.Repeated {
-		return nil, fmt.Errorf("repeated conflict: field='%s%s' (old=%s, new=%s): %w", path, old.Name, boolToStr(old.Repeated), boolToStr(new.Repeated), ErrConflictField)
-	}
-
-	if old.Required != new.Required {
-		return nil, fmt.Errorf("required conflict: field='%s%s' (old=%s, new=%s): %w", path, old.Name, boolToStr(old.Required), boolToStr(new.Required), ErrConflictField)
+		if cfg.promote {
+			cfg.report(Resolution{
+				Kind:        ResolutionPromote,
+				Path:        path + old.Name,
+				Old:         old.Type,
+				New:         new.Type,
+				Resolved:    merged.Type,
+				OldRepeated: old.Repeated,
+				NewRepeated: new.Repeated,
+			})
+			// REPEATED field can not be REQUIRED, then REQUIRED of the scalar field is dropped
+			merged.Repeated = true
+			merged.Required = false
+		} else if err := cfg.conflict(fmt.Errorf("repeated conflict: field='%s%s' (old=%s, new=%s): %w", path, old.Name, boolToStr(old.Repeated), boolToStr(new.Repeated), ErrConflictField)); err != nil {
+			return nil, err
+		}
+	} else if old.Required != new.Required {
+		if cfg.relax {
+			cfg.report(Resolution{
+				Kind:     ResolutionRelax,
+				Path:     path + old.Name,
+				Old:      old.Type,
+				New:      new.Type,
+				Resolved: merged.Type,
+			})
+			merged.Required = false
+		} else if err := cfg.conflict(fmt.Errorf("required conflict: field='%s%s' (old=%s, new=%s): %w", path, old.Name, boolToStr(old.Required), boolToStr(new.Required), ErrConflictField)); err != nil {
+			return nil, err
+		}
 	}
 
-	if old.Schema == nil {
+	// fields of RECORD are dropped if RECORD is widened to other type, such as JSON
+	if merged.Type != bigquery.RecordFieldType && (old.Schema != nil || new.Schema != nil) {
+		merged.Schema = nil
+	} else if old.Schema == nil {
 		merged.Schema = new.Schema
 	} else {
 		if new.Schema != nil {
-			schema, err := merge(path+new.Name+".", old.Schema, new.Schema)
+			schema, err := merge(cfg, path+new.Name+".", old.Schema, new.Schema)
 			if err != nil {
 				return nil, err
 			}
@@ -106,3 +202,15 @@ func mergeField(path string, old, new *bigquery.FieldSchema) (*bigquery.FieldSch
 
 	return &merged, nil
 }
+
+// widenParameters sets MaxLength, Precision and Scale of the widened field. They are kept only from the side of the same type as the widened one, because parameters of other types are invalid for the widened type, e.g. Precision of STRING, or narrower than it.
+func widenParameters(merged, old, new *bigquery.FieldSchema) {
+	switch merged.Type {
+	case new.Type:
+		// parameters of new are copied already
+	case old.Type:
+		merged.MaxLength, merged.Precision, merged.Scale = old.MaxLength, old.Precision, old.Scale
+	default:
+		merged.MaxLength, merged.Precision, merged.Scale = 0, 0, 0
+	}
+}
@@ -2,6 +2,7 @@ package bqs_test
 
 import (
 	"errors"
+	"reflect"
 	"strings"
 	"testing"
 
@@ -299,3 +300,671 @@ func TestMergeConflictError(t *testing.T) {
 		t.Errorf("expected to contain field path, but not: %s", err.Error())
 	}
 }
+
+func TestMergeFieldOrder(t *testing.T) {
+	old := bigquery.Schema{
+		{Name: "b", Type: bigquery.StringFieldType},
+		{Name: "d", Type: bigquery.StringFieldType},
+		{Name: "a", Type: bigquery.StringFieldType},
+		{
+			Name: "r",
+			Type: bigquery.RecordFieldType,
+			Schema: bigquery.Schema{
+				{Name: "y", Type: bigquery.StringFieldType},
+				{Name: "x", Type: bigquery.StringFieldType},
+			},
+		},
+	}
+	new := bigquery.Schema{
+		{Name: "c", Type: bigquery.StringFieldType},
+		{
+			Name: "r",
+			Type: bigquery.RecordFieldType,
+			Schema: bigquery.Schema{
+				{Name: "z", Type: bigquery.StringFieldType},
+				{Name: "x", Type: bigquery.StringFieldType},
+			},
+		},
+		{Name: "a", Type: bigquery.StringFieldType},
+	}
+
+	names := func(schema bigquery.Schema) []string {
+		var result []string
+		for _, field := range schema {
+			result = append(result, field.Name)
+		}
+		return result
+	}
+
+	testCases := map[string]struct {
+		options      []bqs.MergeOption
+		expected     []string
+		expectedNest []string
+	}{
+		"default order": {
+			expected:     []string{"c", "r", "a", "b", "d"},
+			expectedNest: []string{"z", "x", "y"},
+		},
+		"new first": {
+			options:      []bqs.MergeOption{bqs.WithFieldOrder(bqs.OrderNewFirst)},
+			expected:     []string{"c", "r", "a", "b", "d"},
+			expectedNest: []string{"z", "x", "y"},
+		},
+		"old first": {
+			options:      []bqs.MergeOption{bqs.WithFieldOrder(bqs.OrderOldFirst)},
+			expected:     []string{"b", "d", "a", "r", "c"},
+			expectedNest: []string{"y", "x", "z"},
+		},
+		"by name": {
+			options:      []bqs.MergeOption{bqs.WithFieldOrder(bqs.OrderByName)},
+			expected:     []string{"a", "b", "c", "d", "r"},
+			expectedNest: []string{"x", "y", "z"},
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			for i := 0; i < 10; i++ {
+				merged, err := bqs.MergeWith(old, new, tc.options...)
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if got := names(merged); !reflect.DeepEqual(got, tc.expected) {
+					t.Errorf("unexpected order: got %v, want %v", got, tc.expected)
+				}
+				for _, field := range merged {
+					if field.Name != "r" {
+						continue
+					}
+					if got := names(field.Schema); !reflect.DeepEqual(got, tc.expectedNest) {
+						t.Errorf("unexpected nested order: got %v, want %v", got, tc.expectedNest)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestMergeFieldOrderByNameOfAddedFields(t *testing.T) {
+	new := bigquery.Schema{
+		{
+			Name: "b",
+			Type: bigquery.RecordFieldType,
+			Schema: bigquery.Schema{
+				{Name: "z", Type: bigquery.StringFieldType},
+				{Name: "a", Type: bigquery.StringFieldType},
+			},
+		},
+		{Name: "a", Type: bigquery.StringFieldType},
+	}
+
+	merged, err := bqs.MergeWith(nil, new, bqs.WithFieldOrder(bqs.OrderByName))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(merged) != 2 || merged[0].Name != "a" || merged[1].Name != "b" {
+		t.Fatalf("unexpected order: %v", merged)
+	}
+	if nested := merged[1].Schema; len(nested) != 2 || nested[0].Name != "a" || nested[1].Name != "z" {
+		t.Errorf("unexpected nested order: %v", nested)
+	}
+	if new[0].Schema[0].Name != "z" {
+		t.Errorf("source schema must not be modified: %v", new[0].Schema)
+	}
+}
+
+func TestMergeWidening(t *testing.T) {
+	old := bigquery.Schema{
+		{Name: "count", Type: bigquery.IntegerFieldType},
+		{Name: "ratio", Type: bigquery.FloatFieldType},
+		{Name: "name", Type: bigquery.StringFieldType},
+		{
+			Name: "nested",
+			Type: bigquery.RecordFieldType,
+			Schema: bigquery.Schema{
+				{Name: "value", Type: bigquery.IntegerFieldType},
+			},
+		},
+	}
+	new := bigquery.Schema{
+		{Name: "count", Type: bigquery.FloatFieldType},
+		{Name: "ratio", Type: bigquery.IntegerFieldType},
+		{Name: "name", Type: bigquery.StringFieldType},
+		{
+			Name: "nested",
+			Type: bigquery.RecordFieldType,
+			Schema: bigquery.Schema{
+				{Name: "value", Type: bigquery.FloatFieldType},
+			},
+		},
+	}
+
+	if _, err := bqs.Merge(old, new); !errors.Is(err, bqs.ErrConflictField) {
+		t.Errorf("expected conflict without widening, but got %v", err)
+	}
+
+	merged, err := bqs.MergeWith(old, new, bqs.WithWidening(bqs.WidenNumeric))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := bigquery.Schema{
+		{Name: "count", Type: bigquery.FloatFieldType},
+		{Name: "ratio", Type: bigquery.FloatFieldType},
+		{Name: "name", Type: bigquery.StringFieldType},
+		{
+			Name: "nested",
+			Type: bigquery.RecordFieldType,
+			Schema: bigquery.Schema{
+				{Name: "value", Type: bigquery.FloatFieldType},
+			},
+		},
+	}
+	if !bqs.Equal(merged, expected) {
+		t.Errorf("unexpected merged schema: got %v, want %v", merged, expected)
+	}
+
+	conflict := bigquery.Schema{
+		{Name: "name", Type: bigquery.IntegerFieldType},
+	}
+	if _, err := bqs.MergeWith(old, conflict, bqs.WithWidening(bqs.WidenNumeric)); !errors.Is(err, bqs.ErrConflictField) {
+		t.Errorf("expected conflict of STRING and INTEGER, but got %v", err)
+	}
+}
+
+func TestMergeWideningLattice(t *testing.T) {
+	record := &bigquery.FieldSchema{
+		Name: "key",
+		Type: bigquery.RecordFieldType,
+		Schema: bigquery.Schema{
+			{Name: "nested", Type: bigquery.StringFieldType},
+		},
+	}
+
+	testCases := map[string]struct {
+		rules    []bqs.WideningRule
+		old, new bigquery.FieldType
+		expected bigquery.FieldType
+	}{
+		"integer and float":             {[]bqs.WideningRule{bqs.WidenNumeric}, bigquery.IntegerFieldType, bigquery.FloatFieldType, bigquery.FloatFieldType},
+		"integer and numeric":           {[]bqs.WideningRule{bqs.WidenNumeric}, bigquery.IntegerFieldType, bigquery.NumericFieldType, bigquery.NumericFieldType},
+		"numeric and bignumeric":        {[]bqs.WideningRule{bqs.WidenNumeric}, bigquery.BigNumericFieldType, bigquery.NumericFieldType, bigquery.BigNumericFieldType},
+		"integer and bignumeric":        {[]bqs.WideningRule{bqs.WidenNumeric}, bigquery.IntegerFieldType, bigquery.BigNumericFieldType, bigquery.BigNumericFieldType},
+		"numeric and float":             {[]bqs.WideningRule{bqs.WidenNumeric}, bigquery.NumericFieldType, bigquery.FloatFieldType, ""},
+		"date and datetime":             {[]bqs.WideningRule{bqs.WidenTemporal}, bigquery.DateFieldType, bigquery.DateTimeFieldType, bigquery.DateTimeFieldType},
+		"date and timestamp":            {[]bqs.WideningRule{bqs.WidenTemporal}, bigquery.TimestampFieldType, bigquery.DateFieldType, bigquery.TimestampFieldType},
+		"datetime and timestamp":        {[]bqs.WideningRule{bqs.WidenTemporal}, bigquery.DateTimeFieldType, bigquery.TimestampFieldType, bigquery.TimestampFieldType},
+		"time and timestamp":            {[]bqs.WideningRule{bqs.WidenTemporal}, bigquery.TimeFieldType, bigquery.TimestampFieldType, ""},
+		"boolean and string":            {[]bqs.WideningRule{bqs.WidenToString}, bigquery.BooleanFieldType, bigquery.StringFieldType, bigquery.StringFieldType},
+		"date and string":               {[]bqs.WideningRule{bqs.WidenWithString}, bigquery.DateFieldType, bigquery.StringFieldType, bigquery.StringFieldType},
+		"string and float":              {[]bqs.WideningRule{bqs.WidenWithString}, bigquery.StringFieldType, bigquery.FloatFieldType, bigquery.StringFieldType},
+		"integer and boolean":           {[]bqs.WideningRule{bqs.WidenWithString}, bigquery.IntegerFieldType, bigquery.BooleanFieldType, ""},
+		"record and string with string": {[]bqs.WideningRule{bqs.WidenWithString}, bigquery.RecordFieldType, bigquery.StringFieldType, ""},
+		"numeric and float to json":     {[]bqs.WideningRule{bqs.WidenNumeric, bqs.WidenToJSON}, bigquery.NumericFieldType, bigquery.FloatFieldType, bigquery.JSONFieldType},
+		"record and string":             {[]bqs.WideningRule{bqs.WidenToString}, bigquery.RecordFieldType, bigquery.StringFieldType, ""},
+		"record and string to json":     {[]bqs.WideningRule{bqs.WidenToString, bqs.WidenToJSON}, bigquery.RecordFieldType, bigquery.StringFieldType, bigquery.JSONFieldType},
+		"first rule takes precedence":   {[]bqs.WideningRule{bqs.WidenNumeric, bqs.WidenToString}, bigquery.IntegerFieldType, bigquery.FloatFieldType, bigquery.FloatFieldType},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			field := func(fieldType bigquery.FieldType) *bigquery.FieldSchema {
+				if fieldType == bigquery.RecordFieldType {
+					return record
+				}
+				return &bigquery.FieldSchema{Name: "key", Type: fieldType}
+			}
+
+			var resolutions []bqs.Resolution
+			merged, err := bqs.MergeWith(
+				bigquery.Schema{field(tc.old)},
+				bigquery.Schema{field(tc.new)},
+				bqs.WithWidening(tc.rules...),
+				bqs.WithMergeHook(func(r bqs.Resolution) {
+					resolutions = append(resolutions, r)
+				}),
+			)
+			if tc.expected == "" {
+				if !errors.Is(err, bqs.ErrConflictField) {
+					t.Errorf("expected conflict, but got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(merged) != 1 || merged[0].Type != tc.expected || merged[0].Schema != nil {
+				t.Errorf("unexpected merged schema: %v", merged)
+			}
+			if len(resolutions) != 1 || resolutions[0].Resolved != tc.expected || resolutions[0].Old != tc.old || resolutions[0].New != tc.new {
+				t.Errorf("unexpected resolutions: %v", resolutions)
+			}
+		})
+	}
+
+	t.Run("report nested path", func(t *testing.T) {
+		old := bigquery.Schema{
+			{
+				Name: "user",
+				Type: bigquery.RecordFieldType,
+				Schema: bigquery.Schema{
+					{Name: "birthday", Type: bigquery.DateFieldType},
+				},
+			},
+		}
+		new := bigquery.Schema{
+			{
+				Name: "user",
+				Type: bigquery.RecordFieldType,
+				Schema: bigquery.Schema{
+					{Name: "birthday", Type: bigquery.TimestampFieldType},
+				},
+			},
+		}
+
+		var resolutions []bqs.Resolution
+		merged, err := bqs.MergeWith(old, new,
+			bqs.WithWidening(bqs.WidenTemporal),
+			bqs.WithMergeHook(func(r bqs.Resolution) {
+				resolutions = append(resolutions, r)
+			}),
+		)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if merged[0].Schema[0].Type != bigquery.TimestampFieldType {
+			t.Errorf("unexpected merged type: %v", merged[0].Schema[0].Type)
+		}
+		if len(resolutions) != 1 || resolutions[0].Path != "user.birthday" || resolutions[0].Kind != bqs.ResolutionWiden {
+			t.Errorf("unexpected resolutions: %v", resolutions)
+		}
+	})
+}
+
+func TestMergeWideningParameters(t *testing.T) {
+	testCases := map[string]struct {
+		rules    []bqs.WideningRule
+		old, new *bigquery.FieldSchema
+		expected *bigquery.FieldSchema
+	}{
+		"parameters of other type are cleared": {
+			rules:    []bqs.WideningRule{bqs.WidenToString},
+			old:      &bigquery.FieldSchema{Name: "key", Type: bigquery.StringFieldType},
+			new:      &bigquery.FieldSchema{Name: "key", Type: bigquery.NumericFieldType, Precision: 10, Scale: 2},
+			expected: &bigquery.FieldSchema{Name: "key", Type: bigquery.StringFieldType},
+		},
+		"parameters of old side are kept": {
+			rules:    []bqs.WideningRule{bqs.WidenNumeric},
+			old:      &bigquery.FieldSchema{Name: "key", Type: bigquery.NumericFieldType, Precision: 10, Scale: 2},
+			new:      &bigquery.FieldSchema{Name: "key", Type: bigquery.IntegerFieldType},
+			expected: &bigquery.FieldSchema{Name: "key", Type: bigquery.NumericFieldType, Precision: 10, Scale: 2},
+		},
+		"parameters of new side are kept": {
+			rules:    []bqs.WideningRule{bqs.WidenNumeric},
+			old:      &bigquery.FieldSchema{Name: "key", Type: bigquery.NumericFieldType, Precision: 10, Scale: 2},
+			new:      &bigquery.FieldSchema{Name: "key", Type: bigquery.BigNumericFieldType, Precision: 40, Scale: 10},
+			expected: &bigquery.FieldSchema{Name: "key", Type: bigquery.BigNumericFieldType, Precision: 40, Scale: 10},
+		},
+		"parameters of narrower type are cleared": {
+			rules:    []bqs.WideningRule{bqs.WidenNumeric},
+			old:      &bigquery.FieldSchema{Name: "key", Type: bigquery.NumericFieldType, Precision: 10, Scale: 2},
+			new:      &bigquery.FieldSchema{Name: "key", Type: bigquery.BigNumericFieldType},
+			expected: &bigquery.FieldSchema{Name: "key", Type: bigquery.BigNumericFieldType},
+		},
+		"max length of string is kept": {
+			rules:    []bqs.WideningRule{bqs.WidenToString},
+			old:      &bigquery.FieldSchema{Name: "key", Type: bigquery.IntegerFieldType},
+			new:      &bigquery.FieldSchema{Name: "key", Type: bigquery.StringFieldType, MaxLength: 20},
+			expected: &bigquery.FieldSchema{Name: "key", Type: bigquery.StringFieldType, MaxLength: 20},
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			merged, err := bqs.MergeWith(bigquery.Schema{tc.old}, bigquery.Schema{tc.new}, bqs.WithWidening(tc.rules...))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(merged) != 1 {
+				t.Fatalf("unexpected merged schema: %v", merged)
+			}
+			if got := merged[0]; got.Type != tc.expected.Type || got.MaxLength != tc.expected.MaxLength || got.Precision != tc.expected.Precision || got.Scale != tc.expected.Scale {
+				t.Errorf("unexpected merged field: got %+v, want %+v", got, tc.expected)
+			}
+		})
+	}
+}
+
+func TestMergeRelaxation(t *testing.T) {
+	old := bigquery.Schema{
+		{Name: "id", Type: bigquery.StringFieldType, Required: true},
+		{Name: "name", Type: bigquery.StringFieldType},
+		{Name: "count", Type: bigquery.IntegerFieldType, Required: true},
+		{
+			Name:     "user",
+			Type:     bigquery.RecordFieldType,
+			Required: true,
+			Schema: bigquery.Schema{
+				{Name: "email", Type: bigquery.StringFieldType, Required: true},
+			},
+		},
+	}
+	new := bigquery.Schema{
+		{Name: "id", Type: bigquery.StringFieldType},
+		{Name: "name", Type: bigquery.StringFieldType, Required: true},
+		{Name: "count", Type: bigquery.IntegerFieldType, Required: true},
+		{
+			Name: "user",
+			Type: bigquery.RecordFieldType,
+			Schema: bigquery.Schema{
+				{Name: "email", Type: bigquery.StringFieldType},
+			},
+		},
+	}
+
+	if _, err := bqs.Merge(old, new); !errors.Is(err, bqs.ErrConflictField) {
+		t.Errorf("expected conflict without relaxation, but got %v", err)
+	}
+
+	var resolutions []bqs.Resolution
+	merged, err := bqs.MergeWith(old, new,
+		bqs.WithRelaxation(),
+		bqs.WithMergeHook(func(r bqs.Resolution) {
+			resolutions = append(resolutions, r)
+		}),
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := bigquery.Schema{
+		{Name: "id", Type: bigquery.StringFieldType},
+		{Name: "name", Type: bigquery.StringFieldType},
+		{Name: "count", Type: bigquery.IntegerFieldType, Required: true},
+		{
+			Name: "user",
+			Type: bigquery.RecordFieldType,
+			Schema: bigquery.Schema{
+				{Name: "email", Type: bigquery.StringFieldType},
+			},
+		},
+	}
+	if !bqs.Equal(merged, expected) {
+		t.Errorf("unexpected merged schema: got %v, want %v", merged, expected)
+	}
+	for _, field := range merged {
+		if field.Required != (field.Name == "count") {
+			t.Errorf("unexpected required of %s: %v", field.Name, field.Required)
+		}
+	}
+	if merged[3].Schema[0].Required {
+		t.Errorf("nested field should be relaxed")
+	}
+
+	var paths []string
+	for _, r := range resolutions {
+		if r.Kind != bqs.ResolutionRelax {
+			t.Errorf("unexpected resolution: %v", r)
+		}
+		paths = append(paths, r.Path)
+	}
+	if !reflect.DeepEqual(paths, []string{"id", "name", "user", "user.email"}) {
+		t.Errorf("unexpected relaxed fields: %v", paths)
+	}
+	if got := resolutions[0].String(); got != "relax: field='id' (REQUIRED to NULLABLE)" {
+		t.Errorf("unexpected description: %s", got)
+	}
+}
+
+func TestMergeRepeatedPromotion(t *testing.T) {
+	scalar := bigquery.Schema{
+		{Name: "ip", Type: bigquery.StringFieldType, Required: true},
+		{Name: "port", Type: bigquery.IntegerFieldType, Repeated: true},
+		{
+			Name: "user",
+			Type: bigquery.RecordFieldType,
+			Schema: bigquery.Schema{
+				{Name: "name", Type: bigquery.StringFieldType},
+			},
+		},
+		{Name: "tag", Type: bigquery.StringFieldType},
+	}
+	repeated := bigquery.Schema{
+		{Name: "ip", Type: bigquery.StringFieldType, Repeated: true},
+		{Name: "port", Type: bigquery.FloatFieldType},
+		{
+			Name:     "user",
+			Type:     bigquery.RecordFieldType,
+			Repeated: true,
+			Schema: bigquery.Schema{
+				{Name: "email", Type: bigquery.StringFieldType},
+			},
+		},
+		{Name: "tag", Type: bigquery.IntegerFieldType, Repeated: true},
+	}
+
+	if _, err := bqs.MergeWith(scalar, repeated, bqs.WithWidening(bqs.WidenNumeric)); !errors.Is(err, bqs.ErrConflictField) {
+		t.Errorf("expected conflict without promotion, but got %v", err)
+	}
+	if _, err := bqs.MergeWith(scalar, repeated, bqs.WithRepeatedPromotion()); !errors.Is(err, bqs.ErrConflictField) {
+		t.Errorf("expected type conflict, but got %v", err)
+	}
+
+	var resolutions []bqs.Resolution
+	merged, err := bqs.MergeWith(scalar, repeated,
+		bqs.WithRepeatedPromotion(),
+		bqs.WithWidening(bqs.WidenNumeric, bqs.WidenToString),
+		bqs.WithMergeHook(func(r bqs.Resolution) {
+			resolutions = append(resolutions, r)
+		}),
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := bigquery.Schema{
+		{Name: "ip", Type: bigquery.StringFieldType, Repeated: true},
+		{Name: "port", Type: bigquery.FloatFieldType, Repeated: true},
+		{
+			Name:     "user",
+			Type:     bigquery.RecordFieldType,
+			Repeated: true,
+			Schema: bigquery.Schema{
+				{Name: "email", Type: bigquery.StringFieldType},
+				{Name: "name", Type: bigquery.StringFieldType},
+			},
+		},
+		{Name: "tag", Type: bigquery.StringFieldType, Repeated: true},
+	}
+	if !bqs.Equal(merged, expected) {
+		t.Errorf("unexpected merged schema: got %v, want %v", merged, expected)
+	}
+	for _, field := range merged {
+		if !field.Repeated || field.Required {
+			t.Errorf("field %s should be REPEATED and not REQUIRED", field.Name)
+		}
+	}
+
+	var promoted []string
+	for _, r := range resolutions {
+		if r.Kind != bqs.ResolutionPromote {
+			continue
+		}
+		promoted = append(promoted, r.String())
+
+		// port is REPEATED in old schema and scalar in new schema, others are the reverse
+		if oldScalar := r.Path != "port"; r.OldRepeated == oldScalar || r.NewRepeated != oldScalar {
+			t.Errorf("unexpected repeated sides of %s: old=%v, new=%v", r.Path, r.OldRepeated, r.NewRepeated)
+		}
+	}
+	expectedPromoted := []string{
+		"promote: field='ip' (old=scalar, new=REPEATED, resolved=REPEATED STRING)",
+		"promote: field='port' (old=REPEATED, new=scalar, resolved=REPEATED FLOAT)",
+		"promote: field='user' (old=scalar, new=REPEATED, resolved=REPEATED RECORD)",
+		"promote: field='tag' (old=scalar, new=REPEATED, resolved=REPEATED STRING)",
+	}
+	if !reflect.DeepEqual(promoted, expectedPromoted) {
+		t.Errorf("unexpected promotions: got %v, want %v", promoted, expectedPromoted)
+	}
+}
+
+func TestResolutionRecorder(t *testing.T) {
+	rows := []bigquery.Schema{
+		{{Name: "ip", Type: bigquery.StringFieldType}},
+		{{Name: "ip", Type: bigquery.StringFieldType, Repeated: true}, {Name: "port", Type: bigquery.IntegerFieldType}},
+		{{Name: "ip", Type: bigquery.StringFieldType}, {Name: "port", Type: bigquery.FloatFieldType}},
+		{{Name: "port", Type: bigquery.IntegerFieldType, Repeated: true}},
+	}
+
+	recorder := bqs.NewResolutionRecorder()
+	var firsts []int
+	var merged bigquery.Schema
+	for i, row := range rows {
+		var err error
+		merged, err = bqs.MergeWith(merged, row,
+			bqs.WithRepeatedPromotion(),
+			bqs.WithWidening(bqs.WidenNumeric),
+			bqs.WithMergeHook(func(r bqs.Resolution) {
+				if recorder.Record(r) {
+					firsts = append(firsts, i)
+				}
+			}),
+		)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	// ip is promoted at the 2nd and 3rd rows, but only the first one is recorded
+	var promoted []string
+	for _, r := range recorder.Resolutions(bqs.ResolutionPromote) {
+		promoted = append(promoted, r.String())
+	}
+	expected := []string{
+		"promote: field='ip' (old=scalar, new=REPEATED, resolved=REPEATED STRING)",
+		"promote: field='port' (old=scalar, new=REPEATED, resolved=REPEATED FLOAT)",
+	}
+	if !reflect.DeepEqual(promoted, expected) {
+		t.Errorf("unexpected promotions: got %v, want %v", promoted, expected)
+	}
+	if widened := recorder.Resolutions(bqs.ResolutionWiden); len(widened) != 1 || widened[0].Path != "port" {
+		t.Errorf("unexpected widening: %v", widened)
+	}
+	if !reflect.DeepEqual(firsts, []int{1, 2, 3}) {
+		t.Errorf("unexpected rows of first records: %v", firsts)
+	}
+}
+
+func TestMergeAllConflicts(t *testing.T) {
+	old := bigquery.Schema{
+		{Name: "a", Type: bigquery.StringFieldType},
+		{Name: "b", Type: bigquery.StringFieldType, Repeated: true},
+		{Name: "c", Type: bigquery.StringFieldType, Required: true},
+		{Name: "d", Type: bigquery.StringFieldType},
+		{Name: "d", Type: bigquery.StringFieldType},
+		{Name: "ok", Type: bigquery.StringFieldType},
+		{
+			Name: "r",
+			Type: bigquery.RecordFieldType,
+			Schema: bigquery.Schema{
+				{Name: "x", Type: bigquery.IntegerFieldType},
+				{Name: "y", Type: bigquery.IntegerFieldType},
+				{
+					Name: "deep",
+					Type: bigquery.RecordFieldType,
+					Schema: bigquery.Schema{
+						{Name: "z", Type: bigquery.BooleanFieldType},
+					},
+				},
+			},
+		},
+	}
+	new := bigquery.Schema{
+		{Name: "a", Type: bigquery.IntegerFieldType},
+		{Name: "b", Type: bigquery.StringFieldType},
+		{Name: "c", Type: bigquery.StringFieldType},
+		{Name: "d", Type: bigquery.StringFieldType},
+		{Name: "ok", Type: bigquery.StringFieldType},
+		{
+			Name: "r",
+			Type: bigquery.RecordFieldType,
+			Schema: bigquery.Schema{
+				{Name: "x", Type: bigquery.StringFieldType},
+				{Name: "Y", Type: bigquery.IntegerFieldType},
+				{
+					Name: "deep",
+					Type: bigquery.RecordFieldType,
+					Schema: bigquery.Schema{
+						{Name: "z", Type: bigquery.StringFieldType},
+					},
+				},
+			},
+		},
+	}
+
+	t.Run("stop at the first conflict by default", func(t *testing.T) {
+		_, err := bqs.Merge(old, new)
+		if !errors.Is(err, bqs.ErrConflictField) {
+			t.Fatalf("expected conflict, but got %v", err)
+		}
+		if _, ok := err.(interface{ Unwrap() []error }); ok {
+			t.Errorf("expected a single error, but got %v", err)
+		}
+	})
+
+	t.Run("collect all conflicts", func(t *testing.T) {
+		merged, err := bqs.MergeWith(old, new, bqs.WithAllConflicts())
+		if merged != nil {
+			t.Errorf("expected nil schema, but got %v", merged)
+		}
+		if !errors.Is(err, bqs.ErrConflictField) {
+			t.Fatalf("expected conflict, but got %v", err)
+		}
+		joined, ok := err.(interface{ Unwrap() []error })
+		if !ok {
+			t.Fatalf("expected joined errors, but got %v", err)
+		}
+
+		expected := []string{
+			"field='a'",
+			"field='b'",
+			"field='c'",
+			"'d'",
+			"field='r.x'",
+			"'r.Y'",
+			"field='r.deep.z'",
+		}
+		errs := joined.Unwrap()
+		if len(errs) != len(expected) {
+			t.Fatalf("unexpected number of conflicts: %d, %v", len(errs), err)
+		}
+		for i, e := range errs {
+			if !errors.Is(e, bqs.ErrConflictField) {
+				t.Errorf("unexpected error: %v", e)
+			}
+			if !strings.Contains(e.Error(), expected[i]) {
+				t.Errorf("expected to contain %s, but not: %s", expected[i], e.Error())
+			}
+		}
+	})
+
+	t.Run("no conflict", func(t *testing.T) {
+		merged, err := bqs.MergeWith(old[:1], old[:1], bqs.WithAllConflicts())
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !bqs.Equal(merged, old[:1]) {
+			t.Errorf("unexpected merged schema: %v", merged)
+		}
+	})
+
+	t.Run("resolved conflicts are not collected", func(t *testing.T) {
+		_, err := bqs.MergeWith(old, new, bqs.WithAllConflicts(), bqs.WithRelaxation(), bqs.WithRepeatedPromotion(), bqs.WithWidening(bqs.WidenToString))
+		joined, ok := err.(interface{ Unwrap() []error })
+		if !ok {
+			t.Fatalf("expected joined errors, but got %v", err)
+		}
+		if errs := joined.Unwrap(); len(errs) != 2 {
+			t.Errorf("expected only duplicated field names, but got %v", err)
+		}
+	})
+}
@@ -0,0 +1,213 @@
+package bqs
+
+import (
+	"reflect"
+	"strings"
+)
+
+// InferOption is a functional option for InferWith. It configures the behavior of schema inference.
+type InferOption func(cfg *inferConfig)
+
+// inferConfig holds the options of a single inference call. It is created by InferWith and passed through the whole recursive inference.
+type inferConfig struct {
+	base64Bytes   bool
+	bigNumeric    bool
+	mapAsJSON     bool
+	marshaledForm bool
+
+	duration  DurationMode
+	detectors []StringDetector
+
+	nestedArrayField string
+	arrayConflict    ArrayConflictPolicy
+	hook             ResolutionHook
+
+	maxDepth         int
+	deepRecordAsJSON bool
+
+	// static is true if the schema is inferred only from type, not value. It is set by InferType and InferReflectType.
+	static bool
+
+	cache      *Cache
+	registries []*TypeRegistry
+	// variant is computed from the options above by cacheVariant.
+	variant *cacheVariant
+
+	// state of the inference. They are updated while walking the data.
+	depth int
+	path  []string
+	stack []typeFrame
+	// zero is true while inferring a zero value created for nil pointer or empty slice.
+	zero bool
+}
+
+// typeFrame is a struct type that is being inferred and the depth of RECORD where the struct is.
+type typeFrame struct {
+	t     reflect.Type
+	depth int
+}
+
+// maxNestingDepth is the maximum nesting depth of RECORD in BigQuery.
+const maxNestingDepth = 15
+
+func newInferConfig(options ...InferOption) *inferConfig {
+	cfg := &inferConfig{
+		maxDepth: maxNestingDepth,
+	}
+	for _, opt := range options {
+		opt(cfg)
+	}
+	return cfg
+}
+
+// WithBase64Bytes makes a string value encoded in standard base64 be inferred as BYTES. It is useful for data decoded from JSON because encoding/json encodes []byte as base64 string. Note that a short plain string, such as "abcd", is also valid base64 and inferred as BYTES. Elements of an array that are base64 and not, such as ["aGk=", "hello"], are widened to STRING. Use MergeWith with WithWidening(WidenWithString) to widen such fields across rows as well.
+func WithBase64Bytes() InferOption {
+	return func(cfg *inferConfig) {
+		cfg.base64Bytes = true
+	}
+}
+
+// WithBigNumeric makes big.Rat be inferred as BIGNUMERIC instead of NUMERIC. A field can also be BIGNUMERIC by `bqs:"bignumeric"` struct tag.
+func WithBigNumeric() InferOption {
+	return func(cfg *inferConfig) {
+		cfg.bigNumeric = true
+	}
+}
+
+// DurationMode is a policy of inference for time.Duration.
+type DurationMode int
+
+const (
+	// DurationAsInteger infers time.Duration as INTEGER as same as other int64 types. It is the default mode.
+	DurationAsInteger DurationMode = iota
+	// DurationAsInterval infers time.Duration as INTERVAL. The value should be converted to bigquery.IntervalValue, e.g. by bigquery.IntervalValueFromDuration, when the data is inserted.
+	DurationAsInterval
+	// DurationAsNanoseconds infers time.Duration as INTEGER with description that notes the unit is nanoseconds.
+	DurationAsNanoseconds
+)
+
+// durationDescription is the description of INTEGER field inferred from time.Duration by DurationAsNanoseconds.
+const durationDescription = "duration in nanoseconds"
+
+// WithDuration sets the policy of inference for time.Duration. A duration in ISO-8601 string, such as "PT1H30M" in JSON, can be inferred as INTERVAL by WithStringDetector and DetectInterval.
+func WithDuration(mode DurationMode) InferOption {
+	return func(cfg *inferConfig) {
+		cfg.duration = mode
+	}
+}
+
+// WithMapAsJSON makes a nested map be inferred as a single JSON column instead of RECORD. It is useful for free-form data that has various keys. The top level map is still inferred as columns of the table. A struct, map or interface field of a struct can be also JSON by `bigquery:",json"` struct tag.
+func WithMapAsJSON() InferOption {
+	return func(cfg *inferConfig) {
+		cfg.mapAsJSON = true
+	}
+}
+
+// WithNestedArrayField makes a nested array, such as [][]int or [[1, 2], [3]] in JSON, be inferred as REPEATED RECORD that has a single REPEATED field named by the argument. BigQuery can not store array of array directly, then the data must be also converted to the structure, e.g. [{"values": [1, 2]}, {"values": [3]}] with "values" name. Without this option, inference of nested array fails with ErrNestedArray.
+func WithNestedArrayField(name string) InferOption {
+	return func(cfg *inferConfig) {
+		cfg.nestedArrayField = name
+	}
+}
+
+// WithMaxDepth sets the maximum nesting depth of RECORD. The default is 15 that is the limit of BigQuery. Inference of deeper data fails with ErrTooDeepNesting. A recursive type, such as `type Node struct { Children []*Node }`, fails with ErrRecursiveType as soon as a nil pointer or an empty slice of the type being inferred is found, regardless of the depth.
+func WithMaxDepth(depth int) InferOption {
+	return func(cfg *inferConfig) {
+		cfg.maxDepth = depth
+	}
+}
+
+// WithDeepRecordAsJSON makes a RECORD field that exceeds the maximum nesting depth be inferred as JSON instead of returning an error. A recursive type, such as a nil pointer or an empty slice of the struct type being inferred, is also inferred as JSON at the first recursion.
+func WithDeepRecordAsJSON() InferOption {
+	return func(cfg *inferConfig) {
+		cfg.deepRecordAsJSON = true
+	}
+}
+
+// fieldPath returns dotted path of the field from the top level.
+func (x *inferConfig) fieldPath(name string) string {
+	return strings.Join(append(x.path[:len(x.path):len(x.path)], name), ".")
+}
+
+// inStack returns true if the struct type is being inferred at the depth. If depth is negative, any depth matches.
+func (x *inferConfig) inStack(t reflect.Type, depth int) bool {
+	for _, frame := range x.stack {
+		if frame.t == t && (depth < 0 || frame.depth == depth) {
+			return true
+		}
+	}
+	return false
+}
+
+// MergeOption is a functional option for MergeWith. It configures the behavior of merging schemas.
+type MergeOption func(cfg *mergeConfig)
+
+// mergeConfig holds the options of a single merge call.
+type mergeConfig struct {
+	order    FieldOrder
+	widening []WideningRule
+	hook     ResolutionHook
+	relax    bool
+	promote  bool
+
+	// conflicts are collected by WithAllConflicts instead of returning the first one
+	allConflicts bool
+	conflicts    []error
+}
+
+func newMergeConfig(options ...MergeOption) *mergeConfig {
+	cfg := &mergeConfig{}
+	for _, opt := range options {
+		opt(cfg)
+	}
+	return cfg
+}
+
+// FieldOrder is a policy of field order in the merged schema. It is applied to nested fields of RECORD as well.
+type FieldOrder int
+
+const (
+	// OrderNewFirst places fields in the order of the new schema, followed by fields that exist only in the old schema in the order of the old schema. It is the default policy.
+	OrderNewFirst FieldOrder = iota
+	// OrderOldFirst places fields in the order of the old schema, followed by fields that exist only in the new schema in the order of the new schema. Merging schemas of rows one by one with this policy keeps the first-seen order of fields. It is also suitable to update the schema of an existing table because existing columns keep their positions.
+	OrderOldFirst
+	// OrderByName sorts fields by name.
+	OrderByName
+)
+
+// WithFieldOrder sets the policy of field order in the merged schema.
+func WithFieldOrder(order FieldOrder) MergeOption {
+	return func(cfg *mergeConfig) {
+		cfg.order = order
+	}
+}
+
+// WithRelaxation makes a conflict of REQUIRED and NULLABLE field be resolved as NULLABLE instead of returning ErrConflictField. It is same as relaxing a column in BigQuery, which allows REQUIRED to NULLABLE but not the reverse. Use WithMergeHook to know which fields are relaxed.
+func WithRelaxation() MergeOption {
+	return func(cfg *mergeConfig) {
+		cfg.relax = true
+	}
+}
+
+// WithRepeatedPromotion makes a conflict of scalar and REPEATED field be resolved as REPEATED instead of returning ErrConflictField, e.g. "ip": "192.0.2.1" in a row and "ip": ["192.0.2.1", "192.0.2.2"] in another row. A value of the scalar field must be written as an array of single element. Use WithMergeHook to know which fields are promoted.
+func WithRepeatedPromotion() MergeOption {
+	return func(cfg *mergeConfig) {
+		cfg.promote = true
+	}
+}
+
+// WithAllConflicts makes MergeWith walk the whole schema and return all conflicts of type, repeated, required and duplicated field name together instead of stopping at the first one. The returned error joins errors of the conflicts by errors.Join, and it still satisfies errors.Is(err, ErrConflictField).
+func WithAllConflicts() MergeOption {
+	return func(cfg *mergeConfig) {
+		cfg.allConflicts = true
+	}
+}
+
+// conflict returns the error as is, or collects it and returns nil if WithAllConflicts is set.
+func (x *mergeConfig) conflict(err error) error {
+	if !x.allConflicts {
+		return err
+	}
+	x.conflicts = append(x.conflicts, err)
+	return nil
+}
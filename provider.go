@@ -0,0 +1,89 @@
+package bqs
+
+import (
+	"reflect"
+
+	"cloud.google.com/go/bigquery"
+)
+
+// FieldSchemaProvider is implemented by a type that defines its own column representation, e.g. a UUID type stored as STRING. The Name of returned FieldSchema is replaced with the field name inferred from struct tag or map key. If it returns nil, the field is omitted.
+type FieldSchemaProvider interface {
+	BigQuerySchema() *bigquery.FieldSchema
+}
+
+// SchemaProvider is implemented by a type that defines its own fields of RECORD. If the top level data implements SchemaProvider, the returned schema is used as is.
+type SchemaProvider interface {
+	BigQuerySchema() bigquery.Schema
+}
+
+var (
+	fieldSchemaProviderType = reflect.TypeOf((*FieldSchemaProvider)(nil)).Elem()
+	schemaProviderType      = reflect.TypeOf((*SchemaProvider)(nil)).Elem()
+)
+
+// isProviderType returns true if the type or pointer of the type implements FieldSchemaProvider or SchemaProvider.
+func isProviderType(t reflect.Type) bool {
+	for _, it := range []reflect.Type{fieldSchemaProviderType, schemaProviderType} {
+		if t.Implements(it) || reflect.PointerTo(t).Implements(it) {
+			return true
+		}
+	}
+	return false
+}
+
+// implementerOf returns the value that implements the interface type. If only pointer of the value implements it, the pointer is returned. The data must not be nil pointer or nil interface.
+func implementerOf(data reflect.Value, it reflect.Type) (any, bool) {
+	if !data.CanInterface() {
+		return nil, false
+	}
+	if data.Type().Implements(it) {
+		return data.Interface(), true
+	}
+
+	if !reflect.PointerTo(data.Type()).Implements(it) {
+		return nil, false
+	}
+	if data.CanAddr() {
+		return data.Addr().Interface(), true
+	}
+	ptr := reflect.New(data.Type())
+	ptr.Elem().Set(data)
+	return ptr.Interface(), true
+}
+
+// provideFieldSchema returns FieldSchema provided by FieldSchemaProvider or SchemaProvider. The second return value is false if the data implements neither of them.
+func provideFieldSchema(name string, data reflect.Value) (*bigquery.FieldSchema, bool) {
+	if v, ok := implementerOf(data, fieldSchemaProviderType); ok {
+		provided := v.(FieldSchemaProvider).BigQuerySchema()
+		if provided == nil {
+			return nil, true
+		}
+
+		field := *provided
+		field.Name = name
+		field.Schema = cloneSchema(provided.Schema)
+		return &field, true
+	}
+
+	if schema, ok := provideSchema(data); ok {
+		if len(schema) == 0 {
+			return nil, true
+		}
+		return &bigquery.FieldSchema{
+			Name:   name,
+			Type:   bigquery.RecordFieldType,
+			Schema: schema,
+		}, true
+	}
+
+	return nil, false
+}
+
+// provideSchema returns fields of RECORD provided by SchemaProvider. The second return value is false if the data does not implement SchemaProvider.
+func provideSchema(data reflect.Value) (bigquery.Schema, bool) {
+	v, ok := implementerOf(data, schemaProviderType)
+	if !ok {
+		return nil, false
+	}
+	return cloneSchema(v.(SchemaProvider).BigQuerySchema()), true
+}
@@ -0,0 +1,89 @@
+package bqs
+
+import (
+	"reflect"
+	"sync"
+
+	"cloud.google.com/go/bigquery"
+)
+
+// TypeMapper maps a Go type to a field type. The second return value is false if the mapper does not handle the type.
+type TypeMapper func(t reflect.Type) (bigquery.FieldType, bool)
+
+// TypeRegistry is a concurrency-safe set of custom mappings from Go types to field types. It is useful for third-party types that can not implement FieldSchemaProvider, e.g. a UUID type as STRING or a geometry type as GEOGRAPHY. A registered type is inferred as a single column of the field type, and a slice of the type is inferred as REPEATED column.
+type TypeRegistry struct {
+	mu      sync.RWMutex
+	types   map[reflect.Type]bigquery.FieldType
+	mappers []TypeMapper
+}
+
+// NewTypeRegistry creates a new empty TypeRegistry.
+func NewTypeRegistry() *TypeRegistry {
+	return &TypeRegistry{
+		types: make(map[reflect.Type]bigquery.FieldType),
+	}
+}
+
+// Register maps the Go type to the field type. The type is matched exactly, then a pointer type and its element type are distinguished. A pointer to unregistered type is inferred by the element type.
+func (x *TypeRegistry) Register(t reflect.Type, fieldType bigquery.FieldType) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	x.types[t] = fieldType
+}
+
+// RegisterFunc adds the mapping function. Mapping functions are called in the order of registration after exact matching by Register fails.
+func (x *TypeRegistry) RegisterFunc(mapper TypeMapper) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	x.mappers = append(x.mappers, mapper)
+}
+
+// lookup returns the field type mapped to the Go type. It works as empty registry if x is nil.
+func (x *TypeRegistry) lookup(t reflect.Type) (bigquery.FieldType, bool) {
+	if x == nil {
+		return "", false
+	}
+
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+
+	if fieldType, ok := x.types[t]; ok {
+		return fieldType, true
+	}
+	for _, mapper := range x.mappers {
+		if fieldType, ok := mapper(t); ok {
+			return fieldType, true
+		}
+	}
+	return "", false
+}
+
+// defaultRegistry is the global registry used by all inferences.
+var defaultRegistry = NewTypeRegistry()
+
+// RegisterType maps the Go type to the field type globally. It affects all inferences, then it should be called at initialization, e.g. in init function. Mappings of a registry passed by WithTypeRegistry take precedence over global ones.
+func RegisterType(t reflect.Type, fieldType bigquery.FieldType) {
+	defaultRegistry.Register(t, fieldType)
+}
+
+// RegisterTypeFunc adds the mapping function globally. See RegisterType and TypeRegistry.RegisterFunc for details.
+func RegisterTypeFunc(mapper TypeMapper) {
+	defaultRegistry.RegisterFunc(mapper)
+}
+
+// WithTypeRegistry adds the registry of custom type mappings for the inference. Registries are consulted in the order of options, then the global registry by RegisterType. Custom mappings take precedence over FieldSchemaProvider and built-in mappings, but not over struct tags.
+func WithTypeRegistry(registry *TypeRegistry) InferOption {
+	return func(cfg *inferConfig) {
+		cfg.registries = append(cfg.registries, registry)
+	}
+}
+
+// lookupRegisteredType returns the field type mapped by registries of options or the global registry.
+func (x *inferConfig) lookupRegisteredType(t reflect.Type) (bigquery.FieldType, bool) {
+	for _, registry := range x.registries {
+		if fieldType, ok := registry.lookup(t); ok {
+			return fieldType, true
+		}
+	}
+	return defaultRegistry.lookup(t)
+}
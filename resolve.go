@@ -0,0 +1,212 @@
+package bqs
+
+import (
+	"fmt"
+	"sync"
+
+	"cloud.google.com/go/bigquery"
+)
+
+// ResolutionKind is a kind of conflict resolution.
+type ResolutionKind int
+
+const (
+	// ResolutionWiden means the conflicted types are widened to a common type.
+	ResolutionWiden ResolutionKind = iota
+	// ResolutionJSON means the field falls back to JSON because the conflict can not be resolved otherwise.
+	ResolutionJSON
+	// ResolutionRelax means a REQUIRED field is relaxed to NULLABLE.
+	ResolutionRelax
+	// ResolutionPromote means a scalar field is promoted to REPEATED field. A value of the scalar field should be written as an array of single element.
+	ResolutionPromote
+)
+
+// String returns the name of the kind.
+func (x ResolutionKind) String() string {
+	switch x {
+	case ResolutionWiden:
+		return "widen"
+	case ResolutionJSON:
+		return "json"
+	case ResolutionRelax:
+		return "relax"
+	case ResolutionPromote:
+		return "promote"
+	default:
+		return fmt.Sprintf("ResolutionKind(%d)", int(x))
+	}
+}
+
+// Resolution is a report of a conflict that is resolved instead of returning ErrConflictField. It is passed to ResolutionHook.
+type Resolution struct {
+	Kind ResolutionKind
+	// Path is the dotted path of the field from the top level, e.g. "user.tags".
+	Path string
+	// Old and New are the conflicted types. In an array, Old is the type of preceding elements and New is the type of the element. In a merge, they are types of the old and new schema. They are same type for ResolutionRelax and ResolutionPromote unless the type is also widened.
+	Old, New bigquery.FieldType
+	// Resolved is the type of the field after the resolution.
+	Resolved bigquery.FieldType
+	// OldRepeated and NewRepeated are true if the field of the old or new side is REPEATED. They tell which side is the scalar for ResolutionPromote.
+	OldRepeated, NewRepeated bool
+}
+
+// String returns a human readable description of the resolution.
+func (x Resolution) String() string {
+	switch x.Kind {
+	case ResolutionRelax:
+		return fmt.Sprintf("%s: field='%s' (REQUIRED to NULLABLE)", x.Kind, x.Path)
+	case ResolutionPromote:
+		return fmt.Sprintf("%s: field='%s' (old=%s, new=%s, resolved=REPEATED %s)", x.Kind, x.Path, repeatedToStr(x.OldRepeated), repeatedToStr(x.NewRepeated), x.Resolved)
+	}
+	return fmt.Sprintf("%s: field='%s' (old=%s, new=%s, resolved=%s)", x.Kind, x.Path, x.Old, x.New, x.Resolved)
+}
+
+// ResolutionHook is called for each resolved conflict.
+type ResolutionHook func(r Resolution)
+
+// WithInferHook sets the hook that is called when a conflict is resolved in the inference, e.g. by ArrayConflictPolicy.
+func WithInferHook(hook ResolutionHook) InferOption {
+	return func(cfg *inferConfig) {
+		cfg.hook = hook
+	}
+}
+
+// WithMergeHook sets the hook that is called when a conflict is resolved in the merge, e.g. by WithWidening.
+func WithMergeHook(hook ResolutionHook) MergeOption {
+	return func(cfg *mergeConfig) {
+		cfg.hook = hook
+	}
+}
+
+// report calls the hook if it is set.
+func (x *mergeConfig) report(r Resolution) {
+	if x.hook != nil {
+		x.hook(r)
+	}
+}
+
+// ResolutionRecorder is a concurrency-safe record of resolutions reported by hooks. It keeps the first resolution of each pair of kind and path, then it summarizes resolutions over merges of many schemas, e.g. fields promoted by WithRepeatedPromotion whose scalar values must be written as arrays of single element.
+type ResolutionRecorder struct {
+	mu          sync.Mutex
+	resolutions []Resolution
+	seen        map[resolutionKey]struct{}
+}
+
+// resolutionKey identifies resolutions of the same field by the same kind.
+type resolutionKey struct {
+	kind ResolutionKind
+	path string
+}
+
+// NewResolutionRecorder creates a new empty ResolutionRecorder.
+func NewResolutionRecorder() *ResolutionRecorder {
+	return &ResolutionRecorder{
+		seen: make(map[resolutionKey]struct{}),
+	}
+}
+
+// Record records the resolution. It returns true if the resolution is the first one of the kind and path. It can be used as ResolutionHook, e.g. WithMergeHook(func(r Resolution) { recorder.Record(r) }).
+func (x *ResolutionRecorder) Record(r Resolution) bool {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	key := resolutionKey{kind: r.Kind, path: r.Path}
+	if _, ok := x.seen[key]; ok {
+		return false
+	}
+	x.seen[key] = struct{}{}
+	x.resolutions = append(x.resolutions, r)
+	return true
+}
+
+// Resolutions returns the first resolutions of the kind for each path in the order of recording.
+func (x *ResolutionRecorder) Resolutions(kind ResolutionKind) []Resolution {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	var result []Resolution
+	for _, r := range x.resolutions {
+		if r.Kind == kind {
+			result = append(result, r)
+		}
+	}
+	return result
+}
+
+// ArrayConflictPolicy is a policy to resolve conflict of element types in an array, such as [1, "a"] in JSON. Integral and fractional numbers, such as [1, 2.5], are always widened to FLOAT.
+type ArrayConflictPolicy int
+
+const (
+	// ArrayConflictFail makes inference fail with ErrConflictField. It is the default policy.
+	ArrayConflictFail ArrayConflictPolicy = iota
+	// ArrayConflictWiden widens element types to a common type by WidenNumeric and WidenToString, e.g. [1, "a"] is REPEATED STRING. Conflict of RECORD and scalar, or array and scalar, still fails.
+	ArrayConflictWiden
+	// ArrayConflictJSON makes the whole array a single JSON column if element types conflict.
+	ArrayConflictJSON
+)
+
+// WithArrayConflict sets the policy to resolve conflict of element types in an array. Use WithInferHook to know which fields are resolved.
+func WithArrayConflict(policy ArrayConflictPolicy) InferOption {
+	return func(cfg *inferConfig) {
+		cfg.arrayConflict = policy
+	}
+}
+
+// arrayWidening returns widening rules for elements of an array by the policy. If string detectors or WithBase64Bytes are enabled, a type inferred from a string and STRING are always widened to STRING, e.g. ["2024-01-02", "foo"], as same as auto-detection of BigQuery.
+func (x *inferConfig) arrayWidening() []WideningRule {
+	if x.arrayConflict == ArrayConflictWiden {
+		return []WideningRule{WidenNumeric, WidenToString}
+	}
+	if len(x.detectors) > 0 || x.base64Bytes {
+		return []WideningRule{WidenNumeric, WidenWithString}
+	}
+	return []WideningRule{WidenNumeric}
+}
+
+// report calls the hook if it is set.
+func (x *inferConfig) report(r Resolution) {
+	if x.hook != nil {
+		x.hook(r)
+	}
+}
+
+// resolveArrayConflict resolves conflict between the field of preceding elements and the field of an element in an array. It returns the resolved type, or ErrConflictField if the policy can not resolve it.
+func resolveArrayConflict(cfg *inferConfig, name string, field, elem *bigquery.FieldSchema) (bigquery.FieldType, error) {
+	if field.Repeated == elem.Repeated && field.Type != elem.Type {
+		for _, rule := range cfg.arrayWidening() {
+			if widened, ok := rule(field.Type, elem.Type); ok {
+				cfg.report(Resolution{
+					Kind:     ResolutionWiden,
+					Path:     cfg.fieldPath(name),
+					Old:      field.Type,
+					New:      elem.Type,
+					Resolved: widened,
+				})
+				return widened, nil
+			}
+		}
+	}
+
+	if cfg.arrayConflict == ArrayConflictJSON {
+		cfg.report(Resolution{
+			Kind:     ResolutionJSON,
+			Path:     cfg.fieldPath(name),
+			Old:      field.Type,
+			New:      elem.Type,
+			Resolved: bigquery.JSONFieldType,
+		})
+		return bigquery.JSONFieldType, nil
+	}
+
+	if field.Repeated != elem.Repeated {
+		return "", fmt.Errorf("repeated conflict in array: %s: %w", cfg.fieldPath(name), ErrConflictField)
+	}
+	return "", fmt.Errorf("type conflict in array: %s (%s and %s): %w", cfg.fieldPath(name), field.Type, elem.Type, ErrConflictField)
+}
+
+func repeatedToStr(repeated bool) string {
+	if repeated {
+		return "REPEATED"
+	}
+	return "scalar"
+}
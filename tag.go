@@ -0,0 +1,219 @@
+package bqs
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"cloud.google.com/go/bigquery"
+)
+
+// Options of bigquery struct tag. They are same as options supported by bigquery.InferSchema.
+const (
+	// tagOptionNullable marks the field as nullable. bqs infers all fields as NULLABLE, then the option is accepted for compatibility with bigquery.InferSchema.
+	tagOptionNullable = "nullable"
+	// tagOptionJSON makes the struct, map or interface field be stored as a single JSON column instead of RECORD, e.g. a free-form payload of `any` type.
+	tagOptionJSON = "json"
+)
+
+// Options of json struct tag that affect the JSON encoded form of the field.
+const (
+	// jsonOptionString means the field is encoded as JSON string by encoding/json.
+	jsonOptionString = "string"
+)
+
+// Options of bqs struct tag. They are bqs specific options that can not be expressed by bigquery tag, e.g. `bqs:"bignumeric,precision=40,scale=10"`.
+const (
+	// bqsOptionNumeric makes the field NUMERIC regardless of Go type. It is useful for decimal types of third party packages.
+	bqsOptionNumeric = "numeric"
+	// bqsOptionBigNumeric makes the field BIGNUMERIC regardless of Go type.
+	bqsOptionBigNumeric = "bignumeric"
+	// bqsOptionPrecision sets Precision of NUMERIC or BIGNUMERIC field, e.g. `precision=10`.
+	bqsOptionPrecision = "precision"
+	// bqsOptionScale sets Scale of NUMERIC or BIGNUMERIC field, e.g. `scale=2`.
+	bqsOptionScale = "scale"
+)
+
+// fieldTag represents parsed struct tags of a field.
+type fieldTag struct {
+	name string
+	skip bool
+	json bool
+	// quoted is true if the field is encoded as JSON string by `string` option of json tag.
+	quoted bool
+
+	// fieldType is the field type specified by bqs tag. It is empty if not specified.
+	fieldType bigquery.FieldType
+	precision int64
+	scale     int64
+}
+
+// parseFieldTag parses `bigquery` and `json` struct tags of the field. The grammar of `bigquery` tag is same as bigquery.InferSchema, such as `bigquery:"name,nullable"`. If `bigquery` tag exists but has no name, the field name is used as the column name as same as bigquery.InferSchema, even if `json` tag has a name. Only if `bigquery` tag does not exist, `json` tag name is used. Options of `json` tag are always honored because they describe the JSON encoded form of the field, e.g. `json:"id,string"` makes the column STRING.
+func parseFieldTag(field reflect.StructField) (*fieldTag, error) {
+	var tag fieldTag
+	if err := parseBqsTag(field, &tag); err != nil {
+		return nil, err
+	}
+
+	jsonParts := strings.Split(field.Tag.Get("json"), ",")
+	jsonName := jsonParts[0]
+	// other options, such as omitempty, do not change the type. All fields are inferred as NULLABLE anyway.
+	for _, opt := range jsonParts[1:] {
+		if opt == jsonOptionString {
+			tag.quoted = isQuotableType(field.Type)
+		}
+	}
+
+	bqTag, ok := field.Tag.Lookup("bigquery")
+	if !ok || bqTag == "" {
+		switch jsonName {
+		case "-":
+			tag.skip = true
+		case "":
+			tag.name = field.Name
+		default:
+			tag.name = jsonName
+		}
+		return &tag, nil
+	}
+
+	if bqTag == "-" {
+		tag.skip = true
+		return &tag, nil
+	}
+
+	// same as bigquery.InferSchema, json tag name is not used if bigquery tag exists
+	parts := strings.Split(bqTag, ",")
+	tag.name = parts[0]
+	if tag.name == "" {
+		tag.name = field.Name
+	}
+
+	for _, opt := range parts[1:] {
+		switch opt {
+		case tagOptionNullable:
+			// all fields are NULLABLE already
+		case tagOptionJSON:
+			tag.json = true
+		default:
+			return nil, fmt.Errorf("invalid bigquery tag option '%s' of field %s: %w", opt, field.Name, ErrInvalidTag)
+		}
+	}
+
+	if tag.json {
+		t := field.Type
+		if t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+		if t.Kind() != reflect.Struct && t.Kind() != reflect.Map && t.Kind() != reflect.Interface {
+			return nil, fmt.Errorf("json option is available only for struct, map or interface field, but %s is %v: %w", field.Name, field.Type, ErrInvalidTag)
+		}
+	}
+
+	return &tag, nil
+}
+
+// isQuotableType returns true if encoding/json encodes a value of the type as JSON string with `string` option. The option is applied only to string, floating point, integer, boolean and pointer of them.
+func isQuotableType(t reflect.Type) bool {
+	if t.Name() == "" && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch t.Kind() {
+	case reflect.String, reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64:
+		return true
+	default:
+		return false
+	}
+}
+
+// parseBqsTag parses `bqs` struct tag of the field and sets the options to tag.
+func parseBqsTag(field reflect.StructField, tag *fieldTag) error {
+	bqsTag := field.Tag.Get("bqs")
+	if bqsTag == "" {
+		return nil
+	}
+
+	for _, opt := range strings.Split(bqsTag, ",") {
+		key, value, hasValue := strings.Cut(opt, "=")
+		switch {
+		case key == bqsOptionNumeric && !hasValue:
+			tag.fieldType = bigquery.NumericFieldType
+		case key == bqsOptionBigNumeric && !hasValue:
+			tag.fieldType = bigquery.BigNumericFieldType
+		case key == bqsOptionPrecision && hasValue, key == bqsOptionScale && hasValue:
+			n, err := strconv.ParseInt(value, 10, 64)
+			if err != nil || n < 0 {
+				return fmt.Errorf("invalid %s '%s' of field %s: %w", key, value, field.Name, ErrInvalidTag)
+			}
+			if key == bqsOptionPrecision {
+				tag.precision = n
+			} else {
+				tag.scale = n
+			}
+		default:
+			return fmt.Errorf("invalid bqs tag option '%s' of field %s: %w", opt, field.Name, ErrInvalidTag)
+		}
+	}
+
+	if tag.scale > 0 && tag.precision == 0 {
+		return fmt.Errorf("scale requires precision in field %s: %w", field.Name, ErrInvalidTag)
+	}
+	if tag.scale > tag.precision {
+		return fmt.Errorf("scale %d is larger than precision %d in field %s: %w", tag.scale, tag.precision, field.Name, ErrInvalidTag)
+	}
+
+	return nil
+}
+
+// apply applies options of the tag that can be set only after the field type is determined.
+func (x *fieldTag) apply(field *bigquery.FieldSchema) error {
+	if x.precision > 0 {
+		if field.Type != bigquery.NumericFieldType && field.Type != bigquery.BigNumericFieldType {
+			return fmt.Errorf("precision and scale are available only for NUMERIC or BIGNUMERIC, but %s is %s: %w", field.Name, field.Type, ErrInvalidTag)
+		}
+		if err := validateDecimalParameters(field.Type, x.precision, x.scale); err != nil {
+			return fmt.Errorf("field %s: %w", field.Name, err)
+		}
+		field.Precision = x.precision
+		field.Scale = x.scale
+	}
+
+	return nil
+}
+
+// Limits of parameterized NUMERIC and BIGNUMERIC types of BigQuery. Precision must be at most scale plus the maximum number of integer digits.
+const (
+	numericMaxScale        = 9
+	numericMaxIntDigits    = 29
+	bigNumericMaxScale     = 38
+	bigNumericMaxIntDigits = 38
+)
+
+// validateDecimalParameters returns ErrInvalidTag if precision and scale exceed the limits of the field type.
+func validateDecimalParameters(fieldType bigquery.FieldType, precision, scale int64) error {
+	maxScale, maxIntDigits := int64(numericMaxScale), int64(numericMaxIntDigits)
+	if fieldType == bigquery.BigNumericFieldType {
+		maxScale, maxIntDigits = bigNumericMaxScale, bigNumericMaxIntDigits
+	}
+
+	if scale > maxScale {
+		return fmt.Errorf("scale %d exceeds %d of %s: %w", scale, maxScale, fieldType, ErrInvalidTag)
+	}
+	if precision > scale+maxIntDigits {
+		return fmt.Errorf("precision %d exceeds scale %d + %d of %s: %w", precision, scale, maxIntDigits, fieldType, ErrInvalidTag)
+	}
+	return nil
+}
+
+// isRepeatedType returns true if the type is inferred as REPEATED field. []byte and [N]byte are not repeated because they are BYTES.
+func isRepeatedType(t reflect.Type) bool {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return (t.Kind() == reflect.Slice || t.Kind() == reflect.Array) && t.Elem().Kind() != reflect.Uint8
+}
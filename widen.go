@@ -0,0 +1,82 @@
+package bqs
+
+import (
+	"cloud.google.com/go/bigquery"
+)
+
+// WideningRule resolves conflict of field types by a common type that can store values of both types. The second return value is false if the rule does not handle the pair of types. A rule should be symmetric, i.e. the order of arguments does not change the result.
+type WideningRule func(a, b bigquery.FieldType) (bigquery.FieldType, bool)
+
+// WithWidening makes type conflict of a field be resolved by the rules instead of returning ErrConflictField. Rules are applied in the order of arguments and the first resolved type is used, e.g. WithWidening(WidenNumeric, WidenTemporal, WidenToString, WidenToJSON) applies the whole lattice. The rules are applied to nested fields of RECORD as well. Use WithMergeHook to know which fields are widened.
+func WithWidening(rules ...WideningRule) MergeOption {
+	return func(cfg *mergeConfig) {
+		cfg.widening = append(cfg.widening, rules...)
+	}
+}
+
+// WidenNumeric widens numeric types along INTEGER → NUMERIC → BIGNUMERIC and INTEGER → FLOAT. It is useful for data decoded from JSON, where an integral number and a fractional number of the same field are inferred as INTEGER and FLOAT. NUMERIC and FLOAT are not widened because FLOAT can not keep precision of NUMERIC.
+func WidenNumeric(a, b bigquery.FieldType) (bigquery.FieldType, bool) {
+	switch {
+	case isTypePair(a, b, bigquery.IntegerFieldType, bigquery.FloatFieldType):
+		return bigquery.FloatFieldType, true
+	case isTypePair(a, b, bigquery.IntegerFieldType, bigquery.NumericFieldType):
+		return bigquery.NumericFieldType, true
+	case isTypePair(a, b, bigquery.IntegerFieldType, bigquery.BigNumericFieldType),
+		isTypePair(a, b, bigquery.NumericFieldType, bigquery.BigNumericFieldType):
+		return bigquery.BigNumericFieldType, true
+	}
+	return "", false
+}
+
+// WidenTemporal widens temporal types along DATE → DATETIME → TIMESTAMP.
+func WidenTemporal(a, b bigquery.FieldType) (bigquery.FieldType, bool) {
+	switch {
+	case isTypePair(a, b, bigquery.DateFieldType, bigquery.DateTimeFieldType):
+		return bigquery.DateTimeFieldType, true
+	case isTypePair(a, b, bigquery.DateFieldType, bigquery.TimestampFieldType),
+		isTypePair(a, b, bigquery.DateTimeFieldType, bigquery.TimestampFieldType):
+		return bigquery.TimestampFieldType, true
+	}
+	return "", false
+}
+
+// WidenToString widens any pair of scalar types to STRING, e.g. INTEGER and STRING, or BOOLEAN and TIMESTAMP. RECORD and JSON are not widened.
+func WidenToString(a, b bigquery.FieldType) (bigquery.FieldType, bool) {
+	if isScalarType(a) && isScalarType(b) {
+		return bigquery.StringFieldType, true
+	}
+	return "", false
+}
+
+// WidenWithString widens STRING and any other scalar type to STRING, e.g. DATE and STRING. It is useful with WithStringDetector because a string that no detector matches is inferred as STRING while other values of the same field are inferred as the detected type. Unlike WidenToString, a pair of types that are not STRING, such as INTEGER and BOOLEAN, is not widened.
+func WidenWithString(a, b bigquery.FieldType) (bigquery.FieldType, bool) {
+	if (a == bigquery.StringFieldType || b == bigquery.StringFieldType) && isScalarType(a) && isScalarType(b) {
+		return bigquery.StringFieldType, true
+	}
+	return "", false
+}
+
+// WidenToJSON widens any pair of types, including RECORD, to JSON. It should be the last rule because it resolves any conflict of types.
+func WidenToJSON(a, b bigquery.FieldType) (bigquery.FieldType, bool) {
+	return bigquery.JSONFieldType, true
+}
+
+// isScalarType returns true if the field type is neither RECORD nor JSON.
+func isScalarType(t bigquery.FieldType) bool {
+	return t != bigquery.RecordFieldType && t != bigquery.JSONFieldType
+}
+
+// isTypePair returns true if a and b are x and y in any order.
+func isTypePair(a, b, x, y bigquery.FieldType) bool {
+	return (a == x && b == y) || (a == y && b == x)
+}
+
+// widen returns the common type of a and b resolved by widening rules of the config.
+func (x *mergeConfig) widen(a, b bigquery.FieldType) (bigquery.FieldType, bool) {
+	for _, rule := range x.widening {
+		if fieldType, ok := rule(a, b); ok {
+			return fieldType, true
+		}
+	}
+	return "", false
+}